@@ -7,8 +7,13 @@ package ogdl
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/bits"
+	"strconv"
+	"time"
 )
 
 // BinParser and its methods implement a parser for binary OGDL, as defined in the
@@ -25,17 +30,109 @@ import (
 //
 //     length ::= multibyte-integer
 //     data :: byte[length]
+//
+// Multibyte integers (varInt) have the number of bytes that follow the first
+// one in the count of its leading 1 bits, as in 10xxxxxx xxxxxxxx, up to
+// 0xFF and eight more bytes for 64 bit integers.
+//
+// The typed extension (version 1) has a different header, and a type byte
+// at the start of each node, so that Go values are read back with their
+// type:
+//
+//     header ::= 0x01 'T' 0x01
+//     node   ::= 's' chunks     string
+//              | 'b' chunks     []byte
+//              | 'i' int64      int64, 8 bytes, big endian
+//              | 'f' float64    float64, 8 bytes IEEE 754, big endian
+//              | 'd' int64      time.Duration
+//              | 'T' chunks     time.Time, in RFC 3339 format
+//              | 't' | 'F'      true, false
+//              | 'n'            nil
+//
+//     chunks ::= ( length data )* 0x00
 type binParser struct {
 	r    *bufio.Reader
 	last int
 	// n counts the bytes read. Used in log.go.
 	n int
+	// typed is true for streams with the typed extension.
+	typed bool
+
+	// Limits set by BinaryDecoder (0 means no limit). end is the value of n
+	// at which the current graph exceeds BinaryDecoder.MaxBytes.
+	maxNode  int
+	maxDepth int
+	end      int
+
+	// err is the first error found, a *BinaryError.
+	err error
+}
+
+// BinaryError is returned by BinaryDecoder when the input is not well formed
+// binary OGDL, or exceeds one of the limits of the decoder.
+type BinaryError struct {
+	Offset int64 // Bytes read from the stream when the problem was detected
+	Err    error // The underlying error
+}
+
+// Error returns the error in the form 'binary OGDL, byte offset: message'
+func (e *BinaryError) Error() string {
+	return "binary OGDL, byte " + strconv.FormatInt(e.Offset, 10) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error, so that errors.Is can be used with
+// ErrBinaryTruncated and friends.
+func (e *BinaryError) Unwrap() error {
+	return e.Err
+}
+
+// BinaryDecoder reads consecutive binary OGDL graphs, of both the untyped
+// and the typed format, from a stream. The limits guard against malformed
+// or hostile input; zero means no limit.
+type BinaryDecoder struct {
+	MaxNodeSize int   // Maximum length of the content of a node
+	MaxDepth    int   // Maximum level of a node, 1 being the top level
+	MaxBytes    int64 // Maximum size of each graph in the stream
+
+	p   *binParser
+	err error
+}
+
+// NewBinaryDecoder returns a decoder that reads from r. The decoder buffers
+// its input, and may read beyond the last graph decoded.
+func NewBinaryDecoder(r io.Reader) *BinaryDecoder {
+	return &BinaryDecoder{p: newBinParser(r)}
+}
+
+// Decode reads the next graph from the stream. It returns io.EOF when the
+// stream ends before a new graph, and a *BinaryError if the graph is not well
+// formed, or exceeds a limit. Errors other than io.EOF are permanent: the
+// position in the stream is lost.
+func (d *BinaryDecoder) Decode() (*Graph, error) {
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	p := d.p
+	p.maxNode = d.MaxNodeSize
+	p.maxDepth = d.MaxDepth
+	p.end = 0
+	if d.MaxBytes > 0 {
+		p.end = p.n + int(d.MaxBytes)
+	}
+
+	g, err := p.decode()
+	if err != nil && err != io.EOF {
+		d.err = err
+	}
+	return g, err
 }
 
 // NewBytesBinParser creates a parser that can convert a binary OGDL byte stream into an
 // ogdl.Graph object. To actually parse the stream, the method Parse() has to be invoked.
 func newBytesBinParser(b []byte) *binParser {
-	p := &binParser{bufio.NewReader(bytes.NewReader(b)), 0, 0}
+	p := &binParser{r: bufio.NewReader(bytes.NewReader(b))}
 	if p.r == nil {
 		return nil
 	}
@@ -58,10 +155,11 @@ func newFileBinParser(file string) *binParser {
 //NewBinParser creates a parser that can convert a binary OGDL stream into an
 // ogdl.Graph object. To actually parse the stream, the method Parse() has to be invoked.
 func newBinParser(r io.Reader) *binParser {
-	return &binParser{bufio.NewReader(r), 0, 0}
+	return &binParser{r: bufio.NewReader(r)}
 }
 
-// FromBinary converts an OGDL binary stream of bytes into a Graph.
+// FromBinary converts an OGDL binary stream of bytes into a Graph. It returns
+// nil if the stream is not well formed; BinaryDecoder reports why.
 func FromBinary(b []byte) *Graph {
 	p := newBytesBinParser(b)
 	return p.parse()
@@ -77,7 +175,7 @@ func FromBinaryReader(r io.Reader) *Graph {
 // It doesn't create a new buffered reader each time, so it can be used to read
 // OGDL log files.
 func FromBinaryBufioReader(r *bufio.Reader) *Graph {
-	p := &binParser{r, 0, 0}
+	p := &binParser{r: r}
 	return p.parse()
 }
 
@@ -89,127 +187,367 @@ func FromBinaryFile(file string) *Graph {
 
 // Binary converts a Graph to a binary OGDL byte stream.
 func (g *Graph) Binary() []byte {
+	return g.binary(false)
+}
+
+// BinaryTypes converts a Graph to a binary OGDL byte stream with the typed
+// extension, so that FromBinary returns nodes with the same Go types:
+// string, []byte, int64, float64, bool, time.Time, time.Duration and nil.
+// Other integer and float types are converted to int64 and float64, and the
+// rest to strings.
+//
+// Readers that only know the untyped format reject the stream, because of
+// its different header.
+func (g *Graph) BinaryTypes() []byte {
+	return g.binary(true)
+}
+
+// IsBinaryTypes returns true if b starts with the header of the typed
+// extension of binary OGDL.
+func IsBinaryTypes(b []byte) bool {
+	return len(b) >= 3 && b[0] == 1 && b[1] == 'T' && b[2] == 1
+}
+
+func (g *Graph) binary(typed bool) []byte {
 
 	if g == nil {
 		return nil
 	}
 
-	// Header
-	buf := make([]byte, 3)
-	buf[0] = 1
-	buf[1] = 'G'
-	buf[2] = 0
+	buf := &bytes.Buffer{}
+	e := NewBinaryEncoder(buf)
+	e.Types = typed
+	e.Encode(g)
+	return buf.Bytes()
+}
 
-	// The 'root' node is bypassed (it's the 'holder')
-	for _, node := range g.Out {
-		buf = node.bin(1, buf)
+// binChunk is the maximum length of the chunks of a binary node.
+const binChunk = 1 << 20
+
+// BinaryEncoder writes graphs as binary OGDL to a stream. Nodes are written
+// as the graph is walked, so that large graphs are not held in memory twice.
+type BinaryEncoder struct {
+	// Types selects the typed extension of the format (see Graph.BinaryTypes).
+	Types bool
+
+	w   *bufio.Writer
+	r   *refs
+	buf []byte
+}
+
+// NewBinaryEncoder returns an encoder that writes to w.
+func NewBinaryEncoder(w io.Writer) *BinaryEncoder {
+	return &BinaryEncoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes a graph as a complete binary OGDL stream, header and final
+// null byte included, so that a BinaryDecoder can read it back from a stream
+// of consecutive graphs. The root node is not written (it's the 'holder').
+// Nothing is written for a nil graph.
+func (e *BinaryEncoder) Encode(g *Graph) error {
+
+	if g == nil {
+		return nil
+	}
+
+	if e.Types {
+		e.w.Write([]byte{1, 'T', 1})
+	} else {
+		e.w.Write([]byte{1, 'G', 0})
 	}
 
+	e.r = newRefs(g)
+	e.r.enter(g)
+	e.out(g, 1)
+	e.r = nil
+
 	// Ending null
-	buf = append(buf, 0)
+	e.w.WriteByte(0)
 
-	return buf
+	return e.w.Flush()
 }
 
-func (g *Graph) bin(level int, buf []byte) []byte {
+// node writes g and its subnodes.
+func (e *BinaryEncoder) node(g *Graph, level int) {
 
-	// Skip empty nodes
-	b := _bytes(g.This)
-	if len(b) != 0 {
-		buf = append(buf, newVarInt(level)...)
-		buf = append(buf, b...)
-		buf = append(buf, 0)
+	if e.Types {
+		e.varInt(level)
+		e.typed(g.This)
+		e.out(g, level+1)
+		return
+	}
+
+	b, isBytes := g.This.([]byte)
+	if !isBytes {
+		b = _bytes(g.This)
+	}
+
+	// Skip empty nodes, except empty []byte's
+	if len(b) != 0 || b != nil && isBytes {
+		e.varInt(level)
+		if isBytes || !isTextNode(b) {
+			e.w.WriteByte(1)
+			e.chunks(b)
+		} else {
+			e.w.Write(b)
+			e.w.WriteByte(0)
+		}
 		level++
 	}
 
+	e.out(g, level)
+}
+
+// out writes the subnodes of g. The binary format cannot represent shared
+// nodes, so they are written at each occurrence. A node that closes a cycle is
+// written as a reference, +{name}, in a text node.
+func (e *BinaryEncoder) out(g *Graph, level int) {
+
 	for _, node := range g.Out {
-		buf = node.bin(level, buf)
+		if ref, ok := e.r.enter(node); !ok {
+			e.varInt(level)
+			if e.Types {
+				e.typed(ref)
+			} else {
+				e.w.WriteString(ref)
+				e.w.WriteByte(0)
+			}
+			continue
+		}
+		e.node(node, level)
+		e.r.exit(node)
 	}
+}
 
-	return buf
+// typed writes a value as a node of the typed extension.
+func (e *BinaryEncoder) typed(v interface{}) {
+
+	switch v := v.(type) {
+	case nil:
+		e.w.WriteByte('n')
+	case string:
+		e.w.WriteByte('s')
+		e.chunks([]byte(v))
+	case []byte:
+		e.w.WriteByte('b')
+		e.chunks(v)
+	case bool:
+		if v {
+			e.w.WriteByte('t')
+		} else {
+			e.w.WriteByte('F')
+		}
+	case float32:
+		e.uint64('f', math.Float64bits(float64(v)))
+	case float64:
+		e.uint64('f', math.Float64bits(v))
+	case time.Duration:
+		e.uint64('d', uint64(v))
+	case time.Time:
+		e.w.WriteByte('T')
+		e.chunks([]byte(v.Format(time.RFC3339Nano)))
+	default:
+		if i, ok := _int64(v); ok {
+			e.uint64('i', uint64(i))
+		} else {
+			e.w.WriteByte('s')
+			e.chunks(_bytes(v))
+		}
+	}
+}
+
+// uint64 writes a type byte and an integer in 8 bytes, big endian.
+func (e *BinaryEncoder) uint64(typ byte, u uint64) {
+	e.buf = append(e.buf[:0], typ, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.buf[1:], u)
+	e.w.Write(e.buf)
+}
+
+// chunks writes b in chunks of up to binChunk bytes, followed by 0x00.
+//
+//     chunks ::= ( length data )* 0x00
+func (e *BinaryEncoder) chunks(b []byte) {
+	for len(b) > 0 {
+		n := len(b)
+		if n > binChunk {
+			n = binChunk
+		}
+		e.varInt(n)
+		e.w.Write(b[:n])
+		b = b[n:]
+	}
+	e.w.WriteByte(0)
 }
 
-// Parse parses a binary OGDL stream and returns a Graph.
+// varInt writes a variable length integer.
+func (e *BinaryEncoder) varInt(i int) {
+	e.buf = appendVarInt(e.buf[:0], i)
+	e.w.Write(e.buf)
+}
+
+// isTextNode returns true if b can be written as a text node: it has no
+// null bytes and doesn't start with 0x01, that marks binary nodes.
+func isTextNode(b []byte) bool {
+	return len(b) > 0 && b[0] != 1 && bytes.IndexByte(b, 0) < 0
+}
+
+// Parse parses a binary OGDL stream and returns a Graph, or nil if the
+// stream is not well formed.
 func (p *binParser) parse() *Graph {
 
-	if p == nil || !p.header() {
+	if p == nil {
 		return nil
 	}
+	g, _ := p.decode()
+	return g
+}
+
+// decode reads one graph from the stream, checking the limits of the parser.
+// It returns io.EOF if the stream is at its end, or else a *BinaryError.
+func (p *binParser) decode() (*Graph, error) {
+
+	p.err = nil
+	if _, err := p.r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	if !p.header() {
+		p.fail(ErrBinaryHeader)
+		return nil, p.err
+	}
 
 	ev := &SimpleEventHandler{}
+	prev := 0
 
 	for {
-		lev, bin, b := p.line(true)
+		var lev int
+		var v interface{}
 
+		if p.typed {
+			lev, v = p.typedLine(true)
+		} else {
+			var bin bool
+			var b []byte
+			lev, bin, b = p.line(true)
+			// Store the content in the same format as it was sent (string or []byte)
+			if bin {
+				v = b
+			} else {
+				v = string(b)
+			}
+		}
+
+		if p.err != nil {
+			return nil, p.err
+		}
 		if lev == 0 {
 			break
 		}
-		// Store the content in the same format as it was sent (string or []byte)
-		if bin {
-			ev.AddBytesAt(b, lev-1)
-		} else {
-			ev.AddAt(string(b), lev-1)
+		if !p.level(lev, prev) {
+			return nil, p.err
 		}
+		ev.addValueAt(v, lev-1)
+		prev = lev
 	}
-	return ev.Tree()
+	return ev.Tree(), nil
 }
 
-// newVarInt produces a variable integer from an int.
-// Only positive integers are accepted.
-func newVarInt(i int) []byte {
+// skip reads one graph without storing it. It returns io.EOF if the stream
+// is at its end.
+func (p *binParser) skip() error {
 
-	if i < 0 {
-		return nil
+	p.err = nil
+	if _, err := p.r.Peek(1); err != nil {
+		return err
 	}
 
-	if i < 0x80 {
-		b := make([]byte, 1)
-		b[0] = byte(i)
-		return b
+	if !p.header() {
+		p.fail(ErrBinaryHeader)
+		return p.err
 	}
 
-	if i < 0x4000 {
-		b := make([]byte, 2)
-		b[0] = byte(i>>8 | 0x80)
-		b[1] = byte(i & 0xff)
-		return b
+	for {
+		var lev int
+		if p.typed {
+			lev, _ = p.typedLine(false)
+		} else {
+			lev, _, _ = p.line(false)
+		}
+		if p.err != nil {
+			return p.err
+		}
+		if lev == 0 {
+			return nil
+		}
 	}
+}
 
-	if i < 0x200000 {
-		b := make([]byte, 3)
-		b[0] = byte(i>>16 | 0xc0)
-		b[1] = byte(i >> 8 & 0xff)
-		b[2] = byte(i & 0xff)
-		return b
+// level checks the level of a new node against the previous one (nodes can
+// be at most one level deeper) and the maximum depth.
+func (p *binParser) level(lev, prev int) bool {
+	switch {
+	case lev > prev+1:
+		p.fail(ErrBinaryLevel)
+	case p.maxDepth > 0 && lev > p.maxDepth:
+		p.fail(ErrTooDeep)
+	default:
+		return true
 	}
+	return false
+}
 
-	if i < 0x10000000 {
-		b := make([]byte, 4)
-		b[0] = byte(i>>24 | 0xe0)
-		b[1] = byte(i>>16 | 0xff)
-		b[2] = byte(i >> 8 & 0xff)
-		b[3] = byte(i & 0xff)
-		return b
+// fail records the first error found in the stream.
+func (p *binParser) fail(err error) {
+	if p.err == nil {
+		p.err = &BinaryError{Offset: int64(p.n), Err: err}
 	}
+}
 
-	return nil
+// newVarInt produces a variable integer from an int.
+// Only positive integers are accepted.
+func newVarInt(i int) []byte {
+	return appendVarInt(nil, i)
+}
+
+// appendVarInt appends a variable integer to buf. Negative integers are not
+// written.
+func appendVarInt(buf []byte, i int) []byte {
+
+	if i < 0 {
+		return buf
+	}
+	u := uint64(i)
+
+	// n bytes follow the first one, that holds 7-n bits.
+	n := 0
+	for n < 8 && u>>(7*n+7) != 0 {
+		n++
+	}
+
+	buf = append(buf, byte(uint16(0xff00)>>n)|byte(u>>(8*n)))
+	for n--; n >= 0; n-- {
+		buf = append(buf, byte(u>>(8*n)))
+	}
+	return buf
 }
 
 // header is the parser production that reads the header from the stream
 //
-// header ::= 0x01 'G' 0x00
+// header ::= 0x01 'G' 0x00 | 0x01 'T' 0x01
 func (p *binParser) header() bool {
 
 	if p.read() != 1 {
 		return false
 	}
-	if p.read() != 'G' {
-		return false
-	}
-	if p.read() != 0 {
-		return false
+	switch p.read() {
+	case 'G':
+		p.typed = false
+		return p.read() == 0
+	case 'T':
+		p.typed = true
+		return p.read() == 1
 	}
-	return true
+	return false
 }
 
 // varInt is the parser production that reads a variable length integer from the stream.
@@ -220,6 +558,10 @@ func (p *binParser) header() bool {
 //   0x00 - 0x1FFFFF:  110xxxxx xxxxxxxx xxxxxxxx
 //   0x00 - 0xFFFFFFF: 1110xxxx xxxxxxxx xxxxxxxx xxxxxxxx
 //    ...
+//   64 bits:          11111111 xxxxxxxx (8 bytes)
+//
+// It returns -1 at the end of the stream, or if the integer doesn't fit in
+// an int.
 func (p *binParser) varInt() int {
 
 	b0 := p.read()
@@ -228,25 +570,23 @@ func (p *binParser) varInt() int {
 		return b0
 	}
 
-	if b0 < 0xc0 {
-		b1 := p.read()
-		return (b0&0x3f)<<8 | b1
-	}
+	// The leading 1 bits give the number of bytes that follow
+	n := bits.LeadingZeros8(^uint8(b0))
+	u := uint64(b0) & (0xff >> uint(n+1))
 
-	if b0 < 0xe0 {
-		b1 := p.read()
-		b2 := p.read()
-		return ((b0 & 0x1f) << 16) | (b1 << 8) | b2
+	for ; n > 0; n-- {
+		c := p.read()
+		if c < 0 {
+			return -1
+		}
+		u = u<<8 | uint64(c)
 	}
 
-	if b0 < 0xf0 {
-		b1 := p.read()
-		b2 := p.read()
-		b3 := p.read()
-		return ((b0 & 0x0f) << 24) | (b1 << 16) | (b2 << 8) | b3
+	if u > math.MaxInt64 || int(u) < 0 || uint64(int(u)) != u {
+		p.fail(ErrBinaryNode)
+		return -1
 	}
-
-	return -1
+	return int(u)
 }
 
 // line is the parser production that reads one line out of the binary OGDL stream.
@@ -256,7 +596,7 @@ func (p *binParser) varInt() int {
 //     node  ::= text-node | binary-node
 //
 // This function returns:
-// - the level (1..)
+// - the level (1..), or 0 at the end of the graph or on errors (see p.err)
 // - the byte stream
 // - a boolean that is true for binary nodes, false for text nodes
 //
@@ -271,58 +611,152 @@ func (p *binParser) line(write bool) (int, bool, []byte) {
 		return 0, false, nil
 	}
 
-	// create a byte buffer to accumulate the bytes read.
-	buf := bytes.Buffer{}
-
 	// read first byte of the node content.
-	n := p.read()
-
-	// Binary node if n==1
-	if n == 1 {
-		// Read length, then bytes
-		for {
-			n = p.varInt()
-			if n < 0 {
-				break
-			}
-			for ; n != 0; n-- {
-				c := p.read()
-				if c < 0 {
-					return level, true, buf.Bytes()
-				}
-				if write {
-					buf.WriteByte(byte(c))
-				}
-			}
+	c := p.read()
+
+	// Binary node if c==1
+	if c == 1 {
+		b := p.chunks(write)
+		if p.err != nil {
+			return 0, true, nil
 		}
-		return level, true, buf.Bytes()
+		return level, true, b
 	}
 
 	// Text node. Read bytes until 0
+	buf := bytes.Buffer{}
+	for size := 0; c != 0; size++ {
+		if c < 0 {
+			return 0, false, nil
+		}
+		if p.maxNode > 0 && size >= p.maxNode {
+			p.fail(ErrNodeTooLarge)
+			return 0, false, nil
+		}
+		if write {
+			buf.WriteByte(byte(c))
+		}
+		c = p.read()
+	}
+	return level, false, buf.Bytes()
+}
+
+// typedLine is the parser production that reads one line of a stream with
+// the typed extension. It returns the level (1..) and the value, or 0 at the
+// end of the graph or on errors. If write is false, strings and []byte's are
+// not stored.
+func (p *binParser) typedLine(write bool) (int, interface{}) {
 
-	if write {
-		buf.WriteByte(byte(n))
+	level := p.varInt()
+	if level < 1 {
+		return 0, nil
 	}
 
-	for {
-		c := p.read()
-		if c == 0 {
-			return level, false, buf.Bytes()
+	var v interface{}
+
+	switch p.read() {
+	case 's':
+		v = string(p.chunks(write))
+	case 'b':
+		v = p.chunks(write)
+	case 'i':
+		v = int64(p.uint64())
+	case 'f':
+		v = math.Float64frombits(p.uint64())
+	case 'd':
+		v = time.Duration(p.uint64())
+	case 'T':
+		t, err := time.Parse(time.RFC3339Nano, string(p.chunks(true)))
+		if err != nil {
+			p.fail(ErrBinaryNode)
 		}
-		if write {
-			buf.WriteByte(byte(c))
+		v = t
+	case 't':
+		v = true
+	case 'F':
+		v = false
+	case 'n':
+		v = nil
+	case -1:
+		// Error already recorded by read
+	default:
+		p.fail(ErrBinaryNode)
+	}
+
+	if p.err != nil {
+		return 0, nil
+	}
+	return level, v
+}
+
+// chunks reads the content of a binary node, or a node of the typed
+// extension.
+//
+//     chunks ::= ( length data )* 0x00
+func (p *binParser) chunks(write bool) []byte {
+
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	if !write {
+		w = ioutil.Discard
+	}
+
+	// Read length, then bytes
+	for size := 0; ; {
+		n := p.varInt()
+		if n <= 0 {
+			break
+		}
+		if p.maxNode > 0 && n > p.maxNode-size {
+			p.fail(ErrNodeTooLarge)
+			return nil
 		}
+		if p.end > 0 && n > p.end-p.n {
+			p.fail(ErrTooLarge)
+			return nil
+		}
+		size += n
+
+		m, err := io.CopyN(w, p.r, int64(n))
+		p.n += int(m)
+		if err != nil {
+			if err == io.EOF {
+				err = ErrBinaryTruncated
+			}
+			p.fail(err)
+			return nil
+		}
+	}
+	return buf.Bytes()
+}
+
+// uint64 reads an 8 byte big endian integer.
+func (p *binParser) uint64() uint64 {
+	var u uint64
+	for i := 0; i < 8; i++ {
+		u = u<<8 | uint64(p.read()&0xff)
 	}
+	return u
 }
 
 // read reads one character (byte) from the stream, returning it in the for of an int.
 // Returning an int permits signaling an EOS with -1.
 func (p *binParser) read() int {
 
+	if p.end > 0 && p.n >= p.end {
+		p.fail(ErrTooLarge)
+		p.last = -1
+		return -1
+	}
+
 	i, err := p.r.ReadByte()
 
 	c := int(i)
-	if err == io.EOF {
+	if err != nil {
+		if err == io.EOF {
+			err = ErrBinaryTruncated
+		}
+		p.fail(err)
 		c = -1
 	} else {
 		p.n++
@@ -2,7 +2,12 @@ package ogdl
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
 	"testing"
+	"time"
 )
 
 func TestBinParser1(t *testing.T) {
@@ -47,9 +52,22 @@ func TestBinParser1(t *testing.T) {
 	if b != nil {
 		t.Error("newVarInt -1")
 	}
-	b = newVarInt(0x10000000)
-	if b != nil {
-		t.Error("newVarInt to high")
+	// Values of 28 bits or more, up to the largest int
+	for _, v := range []int{0x10000000, 0x7ffffffff, 0x800000000, 1 << 49, math.MaxInt32, math.MaxInt64} {
+		b = newVarInt(v)
+		p = newBytesBinParser(b)
+		if i = p.varInt(); i != v {
+			t.Error("varInt", v, i, b)
+		}
+	}
+	if b = newVarInt(0x10000000); len(b) != 5 || b[0] != 0xf0 || b[1] != 0x10 {
+		t.Error("newVarInt 0x10000000", b)
+	}
+	if b = newVarInt(0x1fffff); b[0] != 0xdf || b[1] != 0xff || b[2] != 0xff {
+		t.Error("newVarInt 0x1fffff", b)
+	}
+	if b = newVarInt(0xfffffff); b[0] != 0xef || b[1] != 0xff {
+		t.Error("newVarInt 0xfffffff", b)
 	}
 
 	// force incorrect header
@@ -157,3 +175,191 @@ func TestBinParser4(t *testing.T) {
 		t.Error("BinParse() failed")
 	}
 }
+
+func TestBinaryNodes(t *testing.T) {
+
+	rnd := rand.New(rand.NewSource(1))
+	payload := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+
+	for _, n := range []int{0, 1, 2, 100, 0x7f, 0x80, 0x4000, binChunk, binChunk + 1, 2*binChunk + 17} {
+		b := payload(n)
+
+		g := New("_")
+		f := g.Add("file")
+		f.Add(b)
+		f.Add("after")
+		g.Add(string([]byte{1, 'x'}))
+		g.Add("a\x00b").Add("c")
+
+		h := FromBinary(g.Binary())
+		if h == nil {
+			t.Fatal("FromBinary returned nil", n)
+		}
+
+		c, ok := h.Node("file").Out[0].This.([]byte)
+		if !ok || !bytes.Equal(c, b) {
+			t.Error("payload differs", n)
+		}
+		if s := h.Node("file").Out[1].ThisString(); s != "after" {
+			t.Error("node after payload", n, s)
+		}
+		if h.Len() != 3 || h.Out[1].ThisString() != "\x01x" || h.Out[2].ThisString() != "a\x00b" || h.Out[2].String() != "c" {
+			t.Error("unsafe strings", n, h.Len())
+		}
+	}
+}
+
+func TestBinaryTypes(t *testing.T) {
+
+	now := time.Date(2025, 3, 1, 12, 30, 0, 123456789, time.FixedZone("CET", 3600))
+	big := string(make([]byte, binChunk+1))
+
+	values := []interface{}{
+		"text", "", big, []byte{0, 1, 2}, []byte{},
+		int64(-7), int64(math.MaxInt64), 3.5, math.Inf(-1),
+		true, false, now, 90 * time.Second, nil,
+	}
+
+	g := New("_")
+	for _, v := range values {
+		g.Add("v").Add(New(v)).Add("child")
+	}
+
+	b := g.BinaryTypes()
+	if !IsBinaryTypes(b) || IsBinaryTypes(g.Binary()) {
+		t.Fatal("IsBinaryTypes")
+	}
+
+	h := FromBinary(b)
+	if h == nil || h.Len() != len(values) {
+		t.Fatal("FromBinary returned", h)
+	}
+
+	for i, v := range values {
+		n := h.Out[i].Out[0]
+		if n.String() != "child" {
+			t.Errorf("value %d: subnode lost", i)
+		}
+		switch w := v.(type) {
+		case []byte:
+			c, ok := n.This.([]byte)
+			if !ok || !bytes.Equal(c, w) {
+				t.Errorf("value %d: got %#v", i, n.This)
+			}
+		case time.Time:
+			c, ok := n.This.(time.Time)
+			if !ok || !c.Equal(w) {
+				t.Errorf("value %d: got %#v", i, n.This)
+			}
+		default:
+			if n.This != v {
+				t.Errorf("value %d: got %#v, want %#v", i, n.This, v)
+			}
+		}
+	}
+
+	// Other numeric types are widened
+	g = New("_")
+	g.Add(int8(3))
+	g.Add(uint16(4))
+	g.Add(float32(0.5))
+	h = FromBinary(g.BinaryTypes())
+	if h.Out[0].This != int64(3) || h.Out[1].This != int64(4) || h.Out[2].This != 0.5 {
+		t.Error("numeric types", h.Out[0].This, h.Out[1].This, h.Out[2].This)
+	}
+}
+
+func TestBinaryStream(t *testing.T) {
+
+	g1 := FromString("a b\nc")
+	g2 := New("_")
+	g2.Add("n").Add(int64(7))
+
+	buf := &bytes.Buffer{}
+	e := NewBinaryEncoder(buf)
+	e.Encode(g1)
+	e.Types = true
+	e.Encode(g2)
+	e.Types = false
+	e.Encode(New("_"))
+
+	if !bytes.Equal(buf.Bytes()[:len(g1.Binary())], g1.Binary()) {
+		t.Error("Encode differs from Binary")
+	}
+
+	d := NewBinaryDecoder(buf)
+	h, err := d.Decode()
+	if err != nil || !g1.Equals(h) {
+		t.Error("Decode 1", err)
+	}
+	h, err = d.Decode()
+	if err != nil || h.Node("n").Out[0].This != int64(7) {
+		t.Error("Decode 2", err)
+	}
+	h, err = d.Decode()
+	if err != nil || h.Len() != 0 {
+		t.Error("Decode 3", err)
+	}
+	if _, err = d.Decode(); err != io.EOF {
+		t.Error("Decode at end", err)
+	}
+}
+
+func TestBinaryDecoderErrors(t *testing.T) {
+
+	big := New("_")
+	big.Add("a").Add("b").Add("c")
+	big.Add(string(bytes.Repeat([]byte{'x'}, 100)))
+
+	tests := []struct {
+		in     []byte
+		limits BinaryDecoder
+		err    error
+		offset int64
+	}{
+		{[]byte{1, 'X', 0, 0}, BinaryDecoder{}, ErrBinaryHeader, 2},
+		{[]byte{1, 'G'}, BinaryDecoder{}, ErrBinaryTruncated, 2},
+		{[]byte{1, 'G', 0, 1, 'a'}, BinaryDecoder{}, ErrBinaryTruncated, 5},
+		{[]byte{1, 'G', 0, 1, 'a', 0}, BinaryDecoder{}, ErrBinaryTruncated, 6},
+		{[]byte{1, 'G', 0, 1, 1, 10, 'a', 0}, BinaryDecoder{}, ErrBinaryTruncated, 8},
+		{[]byte{1, 'G', 0, 1, 'a', 0, 3, 'b', 0, 0}, BinaryDecoder{}, ErrBinaryLevel, 9},
+		{[]byte{1, 'G', 0, 2, 'a', 0, 0}, BinaryDecoder{}, ErrBinaryLevel, 6},
+		{[]byte{1, 'T', 1, 1, 'x', 0}, BinaryDecoder{}, ErrBinaryNode, 5},
+		{[]byte{1, 'T', 1, 1, 'T', 1, 'x', 0, 0}, BinaryDecoder{}, ErrBinaryNode, 8},
+		{big.Binary(), BinaryDecoder{MaxDepth: 2}, ErrTooDeep, 12},
+		{big.Binary(), BinaryDecoder{MaxNodeSize: 50}, ErrNodeTooLarge, 64},
+		{big.BinaryTypes(), BinaryDecoder{MaxNodeSize: 50}, ErrNodeTooLarge, 21},
+		{big.Binary(), BinaryDecoder{MaxBytes: 20}, ErrTooLarge, 20},
+		{big.BinaryTypes(), BinaryDecoder{MaxBytes: 20}, ErrTooLarge, 20},
+	}
+
+	for i, test := range tests {
+		d := NewBinaryDecoder(bytes.NewReader(test.in))
+		d.MaxNodeSize = test.limits.MaxNodeSize
+		d.MaxDepth = test.limits.MaxDepth
+		d.MaxBytes = test.limits.MaxBytes
+
+		g, err := d.Decode()
+		var be *BinaryError
+		if g != nil || !errors.Is(err, test.err) || !errors.As(err, &be) || be.Offset != test.offset {
+			t.Errorf("%d: got %v, want %v at %d", i, err, test.err, test.offset)
+		}
+		if _, err2 := d.Decode(); err2 != err {
+			t.Errorf("%d: error not permanent: %v", i, err2)
+		}
+		if FromBinary(test.in) != nil && test.limits == (BinaryDecoder{}) {
+			t.Errorf("%d: FromBinary accepts malformed input", i)
+		}
+	}
+
+	// Within the limits
+	d := NewBinaryDecoder(bytes.NewReader(big.Binary()))
+	d.MaxDepth, d.MaxNodeSize, d.MaxBytes = 3, 100, int64(len(big.Binary()))
+	if g, err := d.Decode(); err != nil || !g.Equals(big) {
+		t.Error("limits", err)
+	}
+}
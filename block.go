@@ -5,7 +5,7 @@
 package ogdl
 
 import (
-	"errors"
+	"io"
 )
 
 // Ogdl is the main function for parsing OGDL text.
@@ -16,14 +16,7 @@ import (
 //
 //     Graph ::= Line* End
 func (p *Parser) Ogdl() {
-	n, u := p.Space()
-	if u == 0 {
-		return // Error
-	}
-	for i := n; i > 0; i-- {
-		p.UnreadByte()
-	}
-	p.tree(n, false)
+	p.parse(false)
 }
 
 // OgdlTypes is the main function for parsing OGDL text.
@@ -31,14 +24,44 @@ func (p *Parser) Ogdl() {
 // This version tries to convert unquoted strings that can be parsed as ints, floats
 // or bools to their corresponding type in Go (string | int64 | float64 | bool).
 func (p *Parser) OgdlTypes() {
+	p.parse(true)
+}
+
+// parse is the common implementation of Ogdl and OgdlTypes. It returns the
+// first syntax error found, if any. Errors do not stop the parser, except a
+// mixed indentation in the first line.
+func (p *Parser) parse(types bool) error {
+	p.types = types
+
 	n, u := p.Space()
 	if u == 0 {
-		return // Error
+		p.fail(0, ErrSpaceNotUniform)
+		return p.perr
 	}
 	for i := n; i > 0; i-- {
 		p.UnreadByte()
 	}
-	p.tree(n, true)
+	p.tree(n, types)
+
+	// Something stopped the parser before the end of the stream: either a
+	// control character or a line with less indentation than the first one.
+	if !p.eos() {
+		off := p.offset()
+		p.UnreadByte()
+		if c, _ := p.Byte(); IsEndChar(c) {
+			p.fail(off-1, ErrUnexpectedChar)
+		} else {
+			p.fail(off, ErrInvalidIndentation)
+		}
+	}
+
+	if p.perr != nil {
+		return p.perr
+	}
+	if p.err != nil && p.err != io.EOF {
+		return p.err
+	}
+	return nil
 }
 
 // tree reads all lines with indentation >= ns
@@ -76,6 +99,7 @@ func (p *Parser) tree(ns int, types bool) {
 //
 func (p *Parser) line(ns int, types bool) (bool, error) {
 
+	start := p.offset()
 	n, u := p.Space()
 
 	if n < ns {
@@ -97,8 +121,9 @@ func (p *Parser) line(ns int, types bool) (bool, error) {
 
 	level := p.ev.Level()
 
-	if u == 0 && n == 0 {
-		return false, errors.New("non-uniform space")
+	// Mixed tabs and spaces are tolerated only in empty lines
+	if c := p.PeekByte(); u == 0 && c != '#' && !IsBreakChar(c) && !IsEndChar(c) {
+		p.fail(start, ErrSpaceNotUniform)
 	}
 
 	if p.End() {
@@ -111,18 +136,31 @@ func (p *Parser) line(ns int, types bool) (bool, error) {
 		p.Space() // Eat eventual space characters
 	}
 
+	// Pending anchor (level 2), and its position
+	var anchor string
+	var anchorOff int64
+
+	// Levels at which the open groups (flow syntax) start, and their position
+	var groups []int
+	var groupOff []int64
+
+	end := false
+
 	for {
 
 		// Can be:
 
 		// Scalar
+		// Anchor or Reference
+		// Group start or end, or Comma
 		// Break
 		// End
 		// Comment
 		// Block
 
 		if p.End() {
-			return false, nil
+			end = true
+			break
 		}
 
 		if p.Break() {
@@ -133,27 +171,53 @@ func (p *Parser) line(ns int, types bool) (bool, error) {
 			break
 		}
 
-		s, ok := p.Block(n)
+		off := p.offset()
 
-		if ok {
-			p.ev.Add(s)
-			p.Break()
-			break
+		if p.flow(&groups, &groupOff, level) {
+			continue
 		}
+		p.at(off)
 
-		if !types {
-			b, ok := p.Scalar(n)
+		k, name, ref := p.Reference()
 
-			if ok {
-				p.ev.Add(b)
-			}
+		if ref && k == '-' {
+			anchor = name
+			anchorOff = off
+			p.Space()
+			continue
+		}
+
+		if ref {
+			p.reference(name, off)
 		} else {
-			b, ok := p.ScalarType(n)
+			s, ok := p.Block(n)
 
 			if ok {
-				p.ev.AddItf(b)
+				p.ev.Add(s)
+				p.label(&anchor)
+				p.Break()
+				break
+			}
+
+			if !types {
+				b, ok, err := p.scalar(n, len(groups))
+				if err != nil {
+					p.fail(off, err)
+				}
+				if ok {
+					p.ev.Add(b)
+				}
+			} else {
+				b, ok, err := p.scalarType(n, len(groups), p.resolvers)
+				if err != nil {
+					p.fail(off, err)
+				}
+				if ok {
+					p.ev.AddItf(b)
+				}
 			}
 		}
+		p.label(&anchor)
 
 		if p.Break() {
 			break
@@ -163,8 +227,87 @@ func (p *Parser) line(ns int, types bool) (bool, error) {
 		p.ev.Inc()
 	}
 
+	if anchor != "" {
+		p.fail(anchorOff, ErrDanglingAnchor)
+	}
+	if len(groups) != 0 {
+		p.fail(groupOff[0], ErrUnbalancedParens)
+	}
+
+	if end {
+		return false, nil
+	}
+
 	p.ev.SetLevel(level)
 
 	return true, nil
 
 }
+
+// flow handles the separators of the flow syntax, that allow writing a tree
+// in one line:
+//
+//    a (b c, d e), f    ->    a
+//                               b
+//                                 c
+//                               d
+//                                 e
+//                             f
+//
+// A comma returns to the level at which the current group (or the line)
+// started, so that the next node is a sibling of the first one in the group.
+// A group, enclosed in parenthesis, is a sequence of such sibling chains,
+// after which the line continues at the level of the group. It returns true
+// if a separator has been consumed.
+func (p *Parser) flow(groups *[]int, groupOff *[]int64, level int) bool {
+
+	off := p.offset()
+	c, _ := p.Byte()
+
+	switch {
+	case c == ',':
+		if n := len(*groups); n > 0 {
+			p.ev.SetLevel((*groups)[n-1])
+		} else {
+			p.ev.SetLevel(level)
+		}
+	case c == '(':
+		*groups = append(*groups, p.ev.Level())
+		*groupOff = append(*groupOff, off)
+	case c == ')' && len(*groups) > 0:
+		n := len(*groups) - 1
+		p.ev.SetLevel((*groups)[n])
+		*groups = (*groups)[:n]
+		*groupOff = (*groupOff)[:n]
+	default:
+		p.UnreadByte()
+		return false
+	}
+
+	p.Space()
+	return true
+}
+
+// label applies a pending anchor to the last node added.
+func (p *Parser) label(anchor *string) {
+	if *anchor == "" {
+		return
+	}
+	if h, ok := p.ev.(ReferenceHandler); ok {
+		h.Anchor(*anchor)
+	}
+	*anchor = ""
+}
+
+// reference adds a reference to an anchored node, or a string if the event
+// handler doesn't support references.
+func (p *Parser) reference(name string, off int64) {
+	h, ok := p.ev.(ReferenceHandler)
+	if !ok {
+		p.ev.Add("+{" + name + "}")
+		return
+	}
+	if !h.AddReference(name) {
+		p.fail(off, ErrUndefinedReference)
+	}
+}
@@ -8,7 +8,6 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"os"
 
 	"github.com/rveen/ogdl"
@@ -42,7 +41,15 @@ func main() {
 		json = append(json, buf[:n]...)
 	}
 
-	g, _ := ogdl.FromJSON(json)
+	g, err := ogdl.FromJSON(json)
+	if err != nil {
+		println(err.Error())
+		os.Exit(1)
+	}
 
-	fmt.Println(g.Text())
+	// Keys are written in the order of the JSON text, and null as null.
+	if err = ogdl.NewEncoder(os.Stdout).Encode(g); err != nil {
+		println(err.Error())
+		os.Exit(1)
+	}
 }
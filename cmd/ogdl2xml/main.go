@@ -0,0 +1,50 @@
+// ogdl2xml [path] [file]
+//
+// Converts OGDL text to XML, the inverse of xml2ogdl. Nodes whose name
+// starts with '@' are written as attributes. The file is read from stdin if
+// not given, and the whole graph is written if path is not given or is '.'.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+
+	"github.com/rveen/ogdl"
+	"github.com/rveen/ogdl/io/gxml"
+)
+
+func main() {
+
+	flag.Parse()
+
+	path := "."
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+
+	var b []byte
+	var err error
+	if flag.NArg() > 1 {
+		b, err = ioutil.ReadFile(flag.Arg(1))
+	} else {
+		b, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		println(err.Error())
+		os.Exit(1)
+	}
+
+	g, err := ogdl.ParseBytes(b)
+	if err != nil {
+		println(err.Error())
+		os.Exit(1)
+	}
+
+	if path != "." {
+		g = g.Get(path)
+	}
+
+	os.Stdout.Write(gxml.ToXML(g))
+	os.Stdout.WriteString("\n")
+}
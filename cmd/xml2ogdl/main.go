@@ -1,30 +1,29 @@
+// xml2ogdl [-id] [-lossless] <path> <file>
+//
+// Converts an XML file to OGDL text, printing the subtree at path (or all of
+// it, if path is '.').
 package main
 
 import (
-	"bytes"
-	"encoding/xml"
 	"flag"
-	"fmt"
 	"io/ioutil"
-	"strings"
-	"unicode"
+	"os"
 
 	"github.com/rveen/ogdl"
-	"golang.org/x/text/runes"
-	"golang.org/x/text/transform"
-	"golang.org/x/text/unicode/norm"
+	"github.com/rveen/ogdl/io/gxml"
 )
 
 func main() {
 
-	var optId bool
+	var optId, optLossless bool
 
 	flag.BoolVar(&optId, "id", false, "simplify @id's")
+	flag.BoolVar(&optLossless, "lossless", false, "keep namespaces, names and space as they are")
 
 	flag.Parse()
 
 	if flag.NArg() < 2 {
-		println("usage\n  xml2ogdl <path> <file>")
+		println("usage\n  xml2ogdl [-id] [-lossless] <path> <file>")
 		return
 	}
 
@@ -32,100 +31,32 @@ func main() {
 
 	b, err := ioutil.ReadFile(flag.Arg(1))
 	if err != nil {
-		return
+		println(err.Error())
+		os.Exit(1)
 	}
 
-	g := xml2graph(b)
+	var g *ogdl.Graph
+	if optLossless {
+		g, err = gxml.Parse(b, &gxml.Lossless)
+		if err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+	} else {
+		g = gxml.FromXML(b)
+	}
 
 	if path != "." {
 		g = g.Get(path)
 	}
 
 	if optId {
-		simplify(g)
-	}
-
-	fmt.Printf("%s\n", g.Text())
-}
-
-func simplify(g *ogdl.Graph) {
-	if g.Out == nil {
-		return
+		gxml.Simplify(g)
 	}
 
-	for _, n := range g.Out {
-
-		if len(n.Out) == 0 {
-			continue
-		}
-		if n.Out[0].ThisString() == "@id" && len(n.Out) >= 2 {
-			if n.This != "p" {
-				n.This = n.Out[0].Out[0].This
-			}
-			n.Out[0] = n.Out[len(n.Out)-1]
-			n.Out = n.Out[:1]
-		}
-		simplify(n)
+	// The Encoder writes the empty strings of empty elements, as ""
+	if err = ogdl.NewEncoder(os.Stdout).Encode(g); err != nil {
+		println(err.Error())
+		os.Exit(1)
 	}
 }
-
-func xml2graph(b []byte) *ogdl.Graph {
-
-	decoder := xml.NewDecoder(bytes.NewReader(b))
-
-	g := ogdl.New(nil)
-	var key string
-	level := -1
-
-	att := true
-
-	var stack []*ogdl.Graph
-	stack = append(stack, g)
-
-	tr := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-
-	for {
-		// Read tokens from the XML document in a stream.
-		t, _ := decoder.Token()
-		if t == nil {
-			break
-		}
-		// Inspect the type of the token just read.
-		switch se := t.(type) {
-
-		case xml.StartElement:
-			level++
-
-			key = se.Name.Local
-			// No accents in key
-			key, _, _ = transform.String(tr, key)
-			// - -> _
-			key = strings.Replace(key, "-", "_", -1)
-
-			n := stack[len(stack)-1].Add(key)
-			// push
-			stack = append(stack, n)
-			if att {
-				for _, at := range se.Attr {
-					n.Add("@" + at.Name.Local).Add(at.Value)
-				}
-			}
-
-		case xml.CharData:
-
-			val := strings.TrimSpace(string(se))
-			if len(val) > 0 {
-				stack[len(stack)-1].Add(val)
-			}
-
-		case xml.EndElement:
-			level--
-			// pop
-
-			stack = stack[:len(stack)-1]
-
-		}
-	}
-
-	return g
-}
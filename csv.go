@@ -0,0 +1,202 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVOptions are the options of FromCSV and Graph.WriteCSV. A nil
+// *CSVOptions selects the defaults.
+type CSVOptions struct {
+	Comma     rune             // Field separator, as ';' or '\t' (0 means ',')
+	Comment   rune             // Lines starting with this character are ignored (0 for none)
+	Header    []string         // Field names; if nil, FromCSV reads them from the first row
+	Types     bool             // Convert fields to int64, float64 and bool, as FromStringTypes
+	Resolvers []ScalarResolver // Conversions tried before the default ones, if Types is set
+}
+
+// FromCSV reads a CSV (or TSV, with Comma set to '\t') table. The result has
+// a '_' subnode per row, holding the fields of the row, named after the
+// header:
+//
+//	name,port
+//	web,80
+//
+// gives
+//
+//	_
+//	  name web
+//	  port 80
+//
+// which is also the layout produced by Marshal for a slice of structs, so
+// that Decode can read the rows into one. Rows may have fewer fields than
+// the header; columns without a name in the header are named by their
+// number, starting at 1.
+func FromCSV(r io.Reader, opts *CSVOptions) (*Graph, error) {
+
+	if opts == nil {
+		opts = &CSVOptions{}
+	}
+
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.Comment = opts.Comment
+	cr.FieldsPerRecord = -1
+
+	header := opts.Header
+	if header == nil {
+		h, err := cr.Read()
+		if err == io.EOF {
+			return New("_"), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		header = h
+	}
+
+	g := New("_")
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := g.Add("_")
+		for i, s := range rec {
+			name := ""
+			if i < len(header) {
+				name = header[i]
+			}
+			if name == "" {
+				name = strconv.Itoa(i + 1)
+			}
+
+			var v interface{} = s
+			if opts.Types && s != "" {
+				v = typed(s, opts.Resolvers)
+			}
+			row.Add(name).Add(v)
+		}
+	}
+	return g, nil
+}
+
+// CSV writes the subnodes of g as the rows of a CSV table, with a header row.
+// See WriteCSV.
+func (g *Graph) CSV(w io.Writer, columns []string) error {
+	return g.WriteCSV(w, columns, nil)
+}
+
+// WriteCSV writes the subnodes of g as the rows of a table, with a header
+// row. If g holds a list (a '_' node, as produced by FromJSON), its elements
+// are the rows. A single '_' node whose subnodes are fields with a value, as
+// produced by FromCSV for a table of one row, is that row.
+//
+// Each column is a path, as in 'address.city', evaluated on each row with
+// Get. A cell is the value of the node found, or else its subnodes in flow
+// syntax, joined with ', '. Missing fields are empty cells. If columns is
+// nil, they are the names of the subnodes of the rows, in the order in which
+// they are first found.
+//
+// Only Comma and Header (instead of columns as the header row) are used from
+// opts.
+func (g *Graph) WriteCSV(w io.Writer, columns []string, opts *CSVOptions) error {
+	if g == nil {
+		return nil
+	}
+	if opts == nil {
+		opts = &CSVOptions{}
+	}
+
+	rows := g.Out
+	if g.Len() == 1 && g.Out[0].IsList() && !isRow(g.Out[0]) {
+		rows = g.Out[0].Out
+	}
+
+	if columns == nil {
+		seen := make(map[string]bool)
+		for _, r := range rows {
+			for _, n := range r.Out {
+				s := n.ThisString()
+				if !seen[s] {
+					seen[s] = true
+					columns = append(columns, s)
+				}
+			}
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+
+	header := opts.Header
+	if header == nil {
+		header = columns
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	paths := make([]*Graph, len(columns))
+	for i, c := range columns {
+		paths[i] = NewPath(c)
+	}
+
+	rec := make([]string, len(columns))
+	for _, r := range rows {
+		for i, p := range paths {
+			n, _ := r.getPath(p)
+			rec[i] = cell(n)
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// cell returns the text of a field found with WriteCSV.
+func cell(n *Graph) string {
+	switch {
+	case n == nil:
+		return ""
+	case n.Len() == 1 && n.Out[0].Len() == 0:
+		if n.Out[0].This == nil {
+			return ""
+		}
+		return _string(n.Out[0].This)
+	}
+
+	s := make([]string, len(n.Out))
+	for i, c := range n.Out {
+		s[i] = (&Graph{"_", []*Graph{c}}).TextFlow(0)
+	}
+	return strings.Join(s, ", ")
+}
+
+// isRow returns true if the subnodes of g are fields with a value, and not
+// the elements of a list.
+func isRow(g *Graph) bool {
+	for _, n := range g.Out {
+		if n.Len() == 0 || n.IsMap() || n.IsList() {
+			return false
+		}
+	}
+	return g.Len() != 0
+}
@@ -0,0 +1,102 @@
+package ogdl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFromCSV(t *testing.T) {
+
+	in := "name;port;up\nweb;80;true\n\"a;b\";1.5\n"
+
+	g, err := FromCSV(strings.NewReader(in), &CSVOptions{Comma: ';', Types: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := g.Text(); s != "_\n  name\n    web\n  port\n    80\n  up\n    true\n_\n  name\n    a;b\n  port\n    1.5" {
+		t.Error(s)
+	}
+	if v := g.Out[0].Node("port").Out[0].This; v != int64(80) {
+		t.Errorf("%T", v)
+	}
+
+	// Into a slice of structs
+	type row struct {
+		Name string
+		Port float64
+		Up   bool
+	}
+	var rows []row
+	if err := g.Decode(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1].Name != "a;b" || rows[1].Port != 1.5 || !rows[0].Up {
+		t.Error(rows)
+	}
+
+	// Without types, and with a given header
+	g, err = FromCSV(strings.NewReader("1\t2\t3\n"), &CSVOptions{Comma: '\t', Header: []string{"a", ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := g.Text(); s != "_\n  a\n    1\n  2\n    2\n  3\n    3" {
+		t.Error(s)
+	}
+
+	if _, err = FromCSV(strings.NewReader("a\n\"b\n"), nil); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCSV(t *testing.T) {
+
+	g := FromString(`_
+  name web
+  addr
+    city "New York"
+  tags (x, y)
+_
+  name "say \"hi\""
+  addr (city Paris)
+_
+  name db`)
+
+	var b strings.Builder
+	if err := g.CSV(&b, []string{"name", "addr.city", "tags"}); err != nil {
+		t.Fatal(err)
+	}
+	out := "name,addr.city,tags\nweb,New York,\"x, y\"\n\"say \"\"hi\"\"\",Paris,\ndb,,\n"
+	if b.String() != out {
+		t.Errorf("got\n%s", b.String())
+	}
+
+	// Columns from the rows, and a list from FromJSON
+	j, _ := FromJSON([]byte(`[{"a":1,"b":null},{"c":{"d":2}}]`))
+	b.Reset()
+	if err := j.WriteCSV(&b, nil, &CSVOptions{Comma: '\t'}); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); s != "a\tb\tc\n1\t\t\n\t\td 2\n" {
+		t.Errorf("%q", s)
+	}
+
+	// A table of one row, and a list of one element
+	in := "name,port\nweb,80\n"
+	g, _ = FromCSV(strings.NewReader(in), nil)
+	b.Reset()
+	if err := g.CSV(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != in {
+		t.Errorf("%q", b.String())
+	}
+
+	j, _ = FromJSON([]byte(`[{"a":1}]`))
+	b.Reset()
+	if err := j.CSV(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); s != "a\n1\n" {
+		t.Errorf("%q", s)
+	}
+}
@@ -0,0 +1,437 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DecodeError is returned by Unmarshal when a node cannot be stored in the
+// Go value. Path is the path of the node, as in eth0.hosts[1].
+type DecodeError struct {
+	Path string
+	Type reflect.Type // The Go type of the destination, if known
+	Err  error
+}
+
+// Error returns the error in the form path: message (type)
+func (e *DecodeError) Error() string {
+	s := e.Err.Error()
+	if e.Type != nil {
+		s += " (" + e.Type.String() + ")"
+	}
+	if e.Path != "" {
+		s = e.Path + ": " + s
+	}
+	return s
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Unmarshal stores the content of g in the value pointed to by v. See
+// Graph.Decode.
+func Unmarshal(g *Graph, v interface{}) error {
+	return g.Decode(v)
+}
+
+// Decode stores the subnodes of g in the value pointed to by v, which is
+// usually a struct:
+//
+//	type Config struct {
+//	    Timeout time.Duration
+//	    Hosts   []string `ogdl:"hosts"`
+//	}
+//
+//	eth0
+//	  timeout 30s
+//	  hosts (a, b)
+//
+//	err := g.Get("eth0").Decode(&config)
+//
+// Each subnode is stored in the struct field with the same name, given in
+// an ogdl tag, or else the field name (the case is not significant). The
+// tag "-" excludes a field. Subnodes without a field are an error.
+//
+// Scalars are converted following the rules of the Int64, Float64 and Bool
+// methods. The subnodes of a node are the elements of slices and maps.
+// Values that implement encoding.TextUnmarshaler decode themselves from the
+// text of the node. A *Graph field receives the node itself.
+func (g *Graph) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &DecodeError{Type: reflect.TypeOf(v), Err: ErrInvalidArgs}
+	}
+	if g == nil {
+		return nil
+	}
+	d := decoder{make(map[*Graph]bool)}
+	return d.decode(g, rv.Elem(), "")
+}
+
+var (
+	graphType           = reflect.TypeOf((*Graph)(nil))
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decoder holds the nodes being decoded, to detect cycles in the graph.
+type decoder struct {
+	path map[*Graph]bool
+}
+
+// decode stores the subnodes of n in rv.
+func (d decoder) decode(n *Graph, rv reflect.Value, path string) error {
+
+	if rv.Type() == graphType {
+		rv.Set(reflect.ValueOf(n))
+		return nil
+	}
+
+	// Values that decode themselves from text are scalars
+	kind := rv.Kind()
+	if isTextUnmarshaler(rv) {
+		kind = reflect.String
+	}
+
+	// The subnodes of n are walked below: n must not be one of them
+	switch kind {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if d.path[n] {
+			return &DecodeError{path, rv.Type(), ErrCycle}
+		}
+		d.path[n] = true
+		defer delete(d.path, n)
+	}
+
+	switch kind {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return d.decode(n, rv.Elem(), path)
+
+	case reflect.Struct:
+		return d.decodeStruct(n, rv, path)
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return &DecodeError{path, rv.Type(), ErrIncompatibleType}
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		for _, c := range n.Out {
+			key := c.ThisString()
+			e := reflect.New(rv.Type().Elem()).Elem()
+			if err := d.decode(c, e, join(path, key)); err != nil {
+				return err
+			}
+			rv.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), e)
+		}
+		return nil
+
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && n.Len() == 1 {
+			if b, ok := n.Out[0].This.([]byte); ok {
+				rv.SetBytes(append([]byte(nil), b...))
+				return nil
+			}
+		}
+		s := reflect.MakeSlice(rv.Type(), n.Len(), n.Len())
+		for i, c := range n.Out {
+			if err := d.decodeElem(c, s.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		rv.Set(s)
+		return nil
+
+	case reflect.Array:
+		if n.Len() > rv.Len() {
+			return &DecodeError{path, rv.Type(), ErrInvalidIndex}
+		}
+		for i, c := range n.Out {
+			if err := d.decodeElem(c, rv.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Interface:
+		if rv.NumMethod() == 0 {
+			if n.Len() == 1 && n.Out[0].Len() == 0 {
+				if n.Out[0].This != nil {
+					rv.Set(reflect.ValueOf(n.Out[0].This))
+				}
+			} else {
+				rv.Set(reflect.ValueOf(n))
+			}
+			return nil
+		}
+	}
+
+	// A scalar: the only subnode of n
+	switch n.Len() {
+	case 0:
+		return setScalar(nil, rv, path)
+	case 1:
+		if n.Out[0].Len() == 0 {
+			return setScalar(n.Out[0].This, rv, path)
+		}
+	}
+	return &DecodeError{path, rv.Type(), ErrIncompatibleType}
+}
+
+// decodeElem stores an element of a slice or array: a scalar is the node
+// itself, other types are made of its subnodes.
+func (d decoder) decodeElem(n *Graph, rv reflect.Value, path string) error {
+	if rv.Type() == graphType {
+		rv.Set(reflect.ValueOf(n))
+		return nil
+	}
+
+	t := rv.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if n.Len() != 0 {
+			return d.decode(n, rv, path)
+		}
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if !reflect.PtrTo(t).Implements(textUnmarshalerType) {
+			return d.decode(n, rv, path)
+		}
+	}
+
+	if n.Len() != 0 {
+		return &DecodeError{path, rv.Type(), ErrIncompatibleType}
+	}
+	return setScalar(n.This, rv, path)
+}
+
+// decodeStruct stores the subnodes of n in the fields of a struct.
+func (d decoder) decodeStruct(n *Graph, rv reflect.Value, path string) error {
+	fs := fields(rv.Type())
+
+	for _, c := range n.Out {
+		name := c.ThisString()
+		p := join(path, name)
+
+		f := fs.find(name)
+		if f == nil {
+			return &DecodeError{p, nil, ErrUnknownField}
+		}
+
+		fv, err := fieldByIndex(rv, f.index)
+		if err != nil {
+			return &DecodeError{p, rv.Type(), err}
+		}
+		if err = d.decode(c, fv, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setScalar stores a value of a node in rv, converting it as needed.
+func setScalar(v interface{}, rv reflect.Value, path string) error {
+
+	// A node without value, or null
+	if v == nil {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+
+	fail := func() error {
+		return &DecodeError{path, rv.Type(), ErrIncompatibleType}
+	}
+
+	// Values of the right type (from OgdlTypes, or built in Go)
+	if reflect.TypeOf(v).AssignableTo(rv.Type()) {
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+
+	if isTextUnmarshaler(rv) {
+		err := rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(_string(v)))
+		if err != nil {
+			return &DecodeError{path, rv.Type(), err}
+		}
+		return nil
+	}
+
+	if rv.Type() == durationType {
+		if d, ok := _duration(v); ok {
+			rv.SetInt(int64(d))
+			return nil
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(_string(v))
+		return nil
+
+	case reflect.Bool:
+		b, ok := _boolf(v)
+		if !ok {
+			return fail()
+		}
+		rv.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := _int64f(v)
+		if !ok || rv.OverflowInt(i) {
+			return fail()
+		}
+		rv.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, ok := _uint64f(v)
+		if !ok || rv.OverflowUint(u) {
+			return fail()
+		}
+		rv.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, ok := _float64f(v)
+		if !ok || rv.OverflowFloat(f) {
+			return fail()
+		}
+		rv.SetFloat(f)
+
+	default:
+		return fail()
+	}
+	return nil
+}
+
+// _uint64f converts a value to an uint64, including the integers beyond the
+// range of int64, that Marshal writes as text.
+func _uint64f(v interface{}) (uint64, bool) {
+	if u, ok := v.(uint64); ok {
+		return u, true
+	}
+	if i, ok := _int64f(v); ok {
+		return uint64(i), i >= 0
+	}
+	u, err := strconv.ParseUint(_string(v), 10, 64)
+	return u, err == nil
+}
+
+// isTextUnmarshaler returns true if a pointer to the value implements
+// encoding.TextUnmarshaler.
+func isTextUnmarshaler(rv reflect.Value) bool {
+	return rv.CanAddr() && rv.Addr().Type().Implements(textUnmarshalerType)
+}
+
+// join adds an element to a path.
+func join(path, s string) string {
+	if path == "" {
+		return s
+	}
+	return path + "." + s
+}
+
+// field describes a struct field for Decode and Marshal.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields are the fields of a struct, in order.
+type structFields []field
+
+// fields returns the fields of a struct type that can be decoded or
+// encoded, including those of embedded structs.
+func fields(t reflect.Type) structFields {
+	var fs structFields
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("ogdl")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+
+		// Embedded structs without a name add their fields to this one
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for _, f := range fields(ft) {
+				f.index = append([]int{i}, f.index...)
+				fs = append(fs, f)
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			continue // Not exported
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		fs = append(fs, field{name, []int{i}, strings.Contains(","+opts+",", ",omitempty,")})
+	}
+	return fs
+}
+
+// find returns the field with the given name, or one that only differs in
+// case.
+func (fs structFields) find(name string) *field {
+	var f *field
+	for i := range fs {
+		if fs[i].name == name {
+			return &fs[i]
+		}
+		if f == nil && strings.EqualFold(fs[i].name, name) {
+			f = &fs[i]
+		}
+	}
+	return f
+}
+
+// fieldByIndex returns a field, allocating embedded struct pointers.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				if !rv.CanSet() {
+					return rv, ErrIncompatibleType
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testHost struct {
+	Name string
+	Port int `ogdl:"port"`
+}
+
+type testBase struct {
+	Debug bool
+}
+
+type testConfig struct {
+	testBase
+	Timeout time.Duration     `ogdl:"timeout"`
+	Ratio   float32           `ogdl:"ratio,omitempty"`
+	IP      net.IP            `ogdl:"ip"`
+	Hosts   []string          `ogdl:"hosts"`
+	Servers []*testHost       `ogdl:"servers"`
+	Main    testHost          `ogdl:"main"`
+	Labels  map[string]string `ogdl:"labels"`
+	Extra   *Graph            `ogdl:"extra"`
+	Any     interface{}       `ogdl:"any"`
+	Skip    string            `ogdl:"-"`
+}
+
+func TestDecode(t *testing.T) {
+
+	g := FromString(`debug true
+timeout 30s
+ratio 0.5
+ip 10.0.0.1
+hosts (a, b)
+servers
+  _ (name x, port 1)
+  _ (name y, port 2)
+main name z
+labels (env prod, zone eu)
+extra (p, q)
+any 7`)
+
+	var c testConfig
+	if err := g.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	want := testConfig{
+		testBase: testBase{Debug: true},
+		Timeout:  30 * time.Second,
+		Ratio:    0.5,
+		IP:       net.ParseIP("10.0.0.1"),
+		Hosts:    []string{"a", "b"},
+		Servers:  []*testHost{{"x", 1}, {"y", 2}},
+		Main:     testHost{Name: "z"},
+		Labels:   map[string]string{"env": "prod", "zone": "eu"},
+		Extra:    g.Node("extra"),
+		Any:      "7",
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v\nwant %+v", c, want)
+	}
+
+	cases := []struct {
+		in   string
+		path string
+		err  error
+	}{
+		{"main\n  port x", "main.port", ErrIncompatibleType},
+		{"servers\n  _ (name x, size 3)", "servers[0].size", ErrUnknownField},
+		{"hosts\n  a b", "hosts[0]", ErrIncompatibleType},
+	}
+
+	for _, tc := range cases {
+		var c testConfig
+		err := Unmarshal(FromString(tc.in), &c)
+		var derr *DecodeError
+		if !errors.As(err, &derr) || derr.Path != tc.path || !errors.Is(err, tc.err) {
+			t.Errorf("%q: got %v; want %s: %v", tc.in, err, tc.path, tc.err)
+		}
+	}
+}
+
+type testCyclic struct {
+	Sub *testCyclic
+}
+
+func TestDecodeCycle(t *testing.T) {
+
+	// sub contains itself
+	g := FromString("-{a} sub\n  +{a}")
+
+	var c testCyclic
+	if err := g.Decode(&c); !errors.Is(err, ErrCycle) {
+		t.Error("cycle", err)
+	}
+}
@@ -0,0 +1,817 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Document is OGDL text that can be modified through paths, while keeping
+// the parts that are not modified byte for byte: comments, blank lines,
+// quoting style and blocks are preserved.
+//
+//	d, err := ogdl.ParseDocument(b)
+//	d.Set("eth0.timeout", 30)
+//	d.Delete("eth0.mask")
+//	b = d.Bytes()
+//
+// Each modification edits the text and parses it again, so that Graph()
+// always reflects the current text. The edits are done as follows:
+//
+//	Set replaces a single value in the same line in place. Otherwise, the
+//	subnodes of the node are removed, and the new value written after it.
+//
+//	Add writes a new line after the last subnode, with the same indentation.
+//
+//	Missing path elements are created in one line, as in 'a b c value'.
+//
+//	Delete removes the lines of a node and its subnodes. In flow syntax,
+//	as in 'a (b c, d e), f', only the node and the subnodes in its group
+//	are removed, with the comma that separates it from its siblings.
+//
+// A node in the middle of a line, as 'b' in 'a b c', cannot have subnodes in
+// other lines. Adding one splits that line into several lines. The groups
+// and the comma separated nodes of that line are then written in lines of
+// their own.
+//
+// Paths are made of tokens and indexes, as in 'a.b[1]'.
+type Document struct {
+	src  []byte
+	g    *Graph
+	pos  *Positions
+	nl   string // Line break used in the text
+	unit string // Indentation unit used in the text
+}
+
+// edit is the replacement of src[from:to] by text.
+type edit struct {
+	from, to int
+	text     string
+}
+
+// item is a scalar, or a separator of the flow syntax, in a line of text.
+type item struct {
+	from, to int
+	sep      byte // '(', ')' or ',', or 0 for scalars
+	depth    int  // Groups open at the item, not counting its own
+}
+
+// ParseDocument parses OGDL text into a Document.
+func ParseDocument(b []byte) (*Document, error) {
+	d := &Document{nl: "\n", unit: "  "}
+
+	if bytes.Contains(b, []byte("\r\n")) {
+		d.nl = "\r\n"
+	}
+
+	err := d.parse(append([]byte(nil), b...))
+	if err != nil {
+		return nil, err
+	}
+	d.unit = d.indentUnit()
+	return d, nil
+}
+
+// parse parses the given text and makes it the content of the document.
+func (d *Document) parse(src []byte) error {
+	p := NewBytesParser(src)
+	p.TrackPositions()
+	g, err := p.Parse()
+	if err != nil {
+		return err
+	}
+	d.src = src
+	d.g = g
+	d.pos = p.Positions()
+	return nil
+}
+
+// Graph returns the graph that corresponds to the current text. Changes to
+// it are not reflected in the document.
+func (d *Document) Graph() *Graph {
+	return d.g
+}
+
+// Bytes returns the current text of the document.
+func (d *Document) Bytes() []byte {
+	return d.src
+}
+
+// String returns the current text of the document.
+func (d *Document) String() string {
+	return string(d.src)
+}
+
+// WriteTo writes the text of the document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(d.src)
+	return int64(n), err
+}
+
+// Get returns the node at the given path, or nil.
+func (d *Document) Get(path string) *Graph {
+	n, rest, err := d.resolve(path)
+	if err != nil || len(rest) != 0 {
+		return nil
+	}
+	return n
+}
+
+// Set sets the value of the node at the given path, creating it if it
+// doesn't exist. As with Graph.Set, if the value is a *Graph, its subnodes
+// become the subnodes of the node.
+func (d *Document) Set(path string, v interface{}) error {
+	n, rest, err := d.resolve(path)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return d.Add(path, v)
+	}
+	if n == d.g {
+		return ErrInvalidArgs
+	}
+
+	g, isGraph := v.(*Graph)
+	if isGraph && g.Len() != 0 && (!d.lineHead(n) || d.sibling(n)) {
+		if err = d.split(n); err != nil {
+			return err
+		}
+		return d.Set(path, v)
+	}
+
+	end := d.end(n)
+
+	// A single value in the same line is replaced in place.
+	if !isGraph && n.Len() == 1 && n.Out[0].Len() == 0 && d.inline(n.Out[0], end) {
+		c := n.Out[0]
+		return d.apply(edit{d.start(c), d.end(c), d.scalar(v, d.indent(end))})
+	}
+
+	// Remove the subnodes in the same line, and then those in other lines.
+	chain := d.chainEnd(n)
+	e1 := edit{end, chain, ""}
+	if !isGraph {
+		e1.text = " " + d.scalar(v, d.indent(end))
+	}
+
+	if !d.lineHead(n) || d.sibling(n) {
+		return d.apply(e1)
+	}
+
+	e2 := edit{d.lineEnd(chain), d.subtreeEnd(n), ""}
+	if isGraph {
+		buf := &bytes.Buffer{}
+		indent := d.childIndent(n)
+		r := newRefs(g)
+		for _, c := range g.Out {
+			d.render(buf, c, indent, r)
+		}
+		e2.text = buf.String()
+	}
+	return d.apply(e1, e2)
+}
+
+// Add adds a value as a new subnode of the node at the given path, creating
+// the path if it doesn't exist. As with Graph.Add, a *Graph is added as a
+// node.
+func (d *Document) Add(path string, v interface{}) error {
+	n, rest, err := d.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	// Nodes in the middle of a line, or followed by a sibling in that line,
+	// can only get a value in that same line, if they have no subnodes.
+	g, isGraph := v.(*Graph)
+	inline := n != d.g && (!d.lineHead(n) || d.sibling(n))
+	if inline && (n.Len() != 0 || (isGraph && g.Len() != 0)) {
+		if err = d.split(n); err != nil {
+			return err
+		}
+		return d.Add(path, v)
+	}
+
+	// The new text: the missing path elements and the value in one line,
+	// unless the value has subnodes.
+	buf := &bytes.Buffer{}
+	indent := d.childIndent(n)
+
+	var tokens []string
+	for _, s := range rest {
+		tokens = append(tokens, d.scalar(s, indent))
+	}
+	if !isGraph || g.Len() == 0 {
+		if isGraph {
+			v = g.This
+		}
+		tokens = append(tokens, d.scalar(v, indent))
+	}
+
+	if inline {
+		end := d.end(n)
+		return d.apply(edit{end, end, " " + strings.Join(tokens, " ")})
+	}
+
+	if len(tokens) != 0 {
+		buf.WriteString(d.nl + indent + strings.Join(tokens, " "))
+	}
+	if isGraph && g.Len() != 0 {
+		if len(tokens) != 0 {
+			indent += d.unit
+		}
+		d.render(buf, g, indent, newRefs(g))
+	}
+
+	text := buf.String()
+
+	if n != d.g {
+		at := d.subtreeEnd(n)
+		return d.apply(edit{at, at, text})
+	}
+
+	// At the end of the document
+	at := len(d.src)
+	if at == 0 {
+		text = text[len(d.nl):]
+	} else if d.src[at-1] == '\n' {
+		text = text[len(d.nl):] + d.nl
+	}
+	return d.apply(edit{at, at, text})
+}
+
+// Delete removes the node at the given path, and its subnodes.
+func (d *Document) Delete(path string) error {
+	n, rest, err := d.resolve(path)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return ErrNotFound
+	}
+	if n == d.g {
+		return ErrInvalidArgs
+	}
+
+	if d.lineHead(n) && !d.sibling(n) {
+		from := d.lineStart(d.start(n))
+		to := d.subtreeEnd(n)
+
+		// Remove also one line break
+		if to < len(d.src) {
+			to += len(d.nl)
+		} else if from > 0 {
+			from = d.lineEnd(from - 1)
+		}
+		return d.apply(edit{from, to, ""})
+	}
+
+	it, k, j := d.flow(n)
+	if k < 0 {
+		// Not found in its line, which is then the end of a quoted string:
+		// remove from the end of the previous token.
+		from := d.start(n)
+		for from > 0 && IsSpaceChar(d.src[from-1]) {
+			from--
+		}
+		return d.apply(edit{from, d.end(n), ""})
+	}
+
+	// Include the anchor
+	if k > 0 && it[k-1].sep == 0 && isAnchor(string(d.src[it[k-1].from:it[k-1].to])) {
+		k--
+	}
+	from, to := it[k].from, it[j-1].to
+
+	switch {
+	case d.sibling(n) && (k == 0 || it[k-1].sep == ',' || it[k-1].sep == '('):
+		// The first of several siblings: remove up to the next one.
+		to = it[j+1].from
+	case k > 0 && it[k-1].sep == ',':
+		// A sibling after a comma: remove from the end of the previous one.
+		from = it[k-1].from
+		if k > 1 {
+			from = it[k-2].to
+		}
+	case k > 0 && it[k-1].sep == '(' && j < len(it) && it[j].sep == ')':
+		// The only node of a group: remove the group.
+		from = it[k-1].from
+		if k > 1 && it[k-2].sep == 0 {
+			from = it[k-2].to
+		}
+		to = it[j].to
+	case k > 0:
+		// A subnode: remove from the end of its parent.
+		from = it[k-1].to
+	}
+	return d.apply(edit{from, to, ""})
+}
+
+// apply makes the given (non overlapping) edits to the text, and parses it.
+// If the result is not valid OGDL, the document is left unchanged.
+func (d *Document) apply(edits ...edit) error {
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].from == edits[j].from {
+			return edits[i].to > edits[j].to
+		}
+		return edits[i].from > edits[j].from
+	})
+
+	src := append([]byte(nil), d.src...)
+	for _, e := range edits {
+		if e.from == e.to && e.text == "" {
+			continue
+		}
+		src = append(src[:e.from], append([]byte(e.text), src[e.to:]...)...)
+	}
+	return d.parse(src)
+}
+
+// split breaks the line that contains n, so that n starts a line. This is
+// needed to add subnodes to n in other lines.
+func (d *Document) split(n *Graph) error {
+
+	if e, ok := d.unflow(n); ok {
+		return d.apply(e)
+	}
+
+	path := d.ancestors(n)
+
+	// The line head is the last ancestor that starts a line
+	i := len(path) - 1
+	for i > 0 && !d.lineHead(path[i]) {
+		i--
+	}
+
+	base := d.indent(d.start(path[i]))
+	var edits []edit
+
+	for j := i + 1; j < len(path); j++ {
+		from := d.end(path[j-1])
+		to := from
+		for to < len(d.src) && IsSpaceChar(d.src[to]) {
+			to++
+		}
+		edits = append(edits, edit{from, to, d.nl + base + strings.Repeat(d.unit, j-i)})
+	}
+	return d.apply(edits...)
+}
+
+// resolve follows the path from the root. It returns the last node found
+// and the path elements that were not found.
+func (d *Document) resolve(path string) (*Graph, []string, error) {
+
+	n := d.g
+	p := NewPath(path)
+
+	for i, e := range p.Out {
+		var next *Graph
+
+		switch e.ThisString() {
+		case TypeIndex:
+			next = n.GetAt(int(e.Int64(-1)))
+			if next == nil {
+				return nil, nil, ErrInvalidIndex
+			}
+		case TypeSelector, TypeArguments, TypeGroup:
+			return nil, nil, ErrInvalidArgs
+		default:
+			next = n.Node(e.ThisString())
+		}
+
+		if next == nil {
+			var rest []string
+			for _, e := range p.Out[i:] {
+				if e.Len() != 0 {
+					return nil, nil, ErrInvalidIndex
+				}
+				rest = append(rest, e.ThisString())
+			}
+			return n, rest, nil
+		}
+		n = next
+	}
+	return n, nil, nil
+}
+
+// ancestors returns the path from the root to n, both included.
+func (d *Document) ancestors(n *Graph) []*Graph {
+	seen := make(map[*Graph]bool)
+
+	var find func(g *Graph, path []*Graph) []*Graph
+	find = func(g *Graph, path []*Graph) []*Graph {
+		path = append(path, g)
+		if g == n {
+			return path
+		}
+		if seen[g] {
+			return nil
+		}
+		seen[g] = true
+		for _, c := range g.Out {
+			if r := find(c, path); r != nil {
+				return r
+			}
+		}
+		return nil
+	}
+	return find(d.g, nil)
+}
+
+// start returns the offset of the text of a node.
+func (d *Document) start(n *Graph) int {
+	return int(d.pos.Pos(n).Offset)
+}
+
+// end returns the offset after the text of a node.
+func (d *Document) end(n *Graph) int {
+	it, k, _ := d.flow(n)
+	if k < 0 {
+		i := d.start(n)
+		return tokenEnd(d.src, i, len(d.indent(i)), 0)
+	}
+	return it[k].to
+}
+
+// inline returns true if node n starts after offset 'after', in the same line.
+func (d *Document) inline(n *Graph, after int) bool {
+	i := d.start(n)
+	return i >= after && bytes.IndexByte(d.src[after:i], '\n') < 0
+}
+
+// chainEnd returns the end of the last node or group in the same line as n
+// that descends from it, or the end of n if there is none.
+func (d *Document) chainEnd(n *Graph) int {
+	it, k, j := d.flow(n)
+	if k < 0 {
+		return d.end(n)
+	}
+	return it[j-1].to
+}
+
+// sibling returns true if n is followed by a comma and a sibling in the same
+// line, as 'a' in 'a b, c d'.
+func (d *Document) sibling(n *Graph) bool {
+	it, k, j := d.flow(n)
+	return k >= 0 && j+1 < len(it) && it[j].sep == ',' && it[j+1].sep != ')'
+}
+
+// flow returns the items of the line that contains n, the index of n in
+// them, and the index of the first item that follows the nodes and groups
+// that descend from n in that line. The index of n is -1 if it is not found.
+func (d *Document) flow(n *Graph) ([]item, int, int) {
+	i := d.start(n)
+	it := d.items(i)
+
+	k := 0
+	for k < len(it) && (it[k].from != i || it[k].sep != 0) {
+		k++
+	}
+	if k == len(it) {
+		return it, -1, -1
+	}
+
+	// Nodes and groups deeper than n, or at its depth but not after a comma
+	j := k + 1
+	for j < len(it) && (it[j].depth > it[k].depth || it[j].depth == it[k].depth && it[j].sep != ',') {
+		j++
+	}
+	return it, k, j
+}
+
+// items returns the scalars and separators of the line that contains offset
+// i, following the rules of Parser.line and Parser.flow. It stops at the end
+// of the line, at a comment or after a block.
+func (d *Document) items(i int) []item {
+	ind := len(d.indent(i))
+	i = d.lineStart(i) + ind
+
+	var it []item
+	depth := 0
+
+	for i < len(d.src) {
+		c := d.src[i]
+		switch {
+		case IsSpaceChar(c):
+			i++
+			continue
+		case IsBreakChar(c) || IsEndChar(c):
+			return it
+		case c == '#' && i+1 < len(d.src) && IsSpaceChar(d.src[i+1]):
+			return it
+		case c == ',':
+			it = append(it, item{i, i + 1, c, depth})
+		case c == '(':
+			it = append(it, item{i, i + 1, c, depth})
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+			it = append(it, item{i, i + 1, c, depth})
+		default:
+			j := tokenEnd(d.src, i, ind, depth)
+			if j == i {
+				return it
+			}
+			it = append(it, item{i, j, 0, depth})
+			i = j
+			continue
+		}
+		i++
+	}
+	return it
+}
+
+// unflow returns the edit that writes the line that contains n without
+// separators: the nodes after a comma in lines of their own, and the nodes in
+// groups as subnodes in other lines. It returns false if there are no
+// separators in that line.
+func (d *Document) unflow(n *Graph) (edit, bool) {
+
+	type node struct {
+		text string
+		out  []*node
+	}
+
+	i := d.start(n)
+	it := d.items(i)
+
+	// The same levels as Parser.line
+	root := &node{}
+	last := []*node{root}
+	var groups []int
+	level, anchor, flow := 1, "", false
+
+	for _, t := range it {
+		s := string(d.src[t.from:t.to])
+		switch t.sep {
+		case ',':
+			level = 1
+			if len(groups) != 0 {
+				level = groups[len(groups)-1]
+			}
+		case '(':
+			groups = append(groups, level)
+		case ')':
+			level = groups[len(groups)-1]
+			groups = groups[:len(groups)-1]
+		default:
+			if isAnchor(s) {
+				anchor += s + " "
+				continue
+			}
+			c := &node{text: anchor + s}
+			anchor = ""
+			p := last[level-1]
+			p.out = append(p.out, c)
+			last = append(last[:level], c)
+			level++
+			continue
+		}
+		flow = true
+	}
+	if !flow {
+		return edit{}, false
+	}
+
+	// Chains of single subnodes in one line
+	buf := &bytes.Buffer{}
+	var write func(c *node, indent string)
+	write = func(c *node, indent string) {
+		buf.WriteString(d.nl + indent + c.text)
+		for len(c.out) == 1 {
+			c = c.out[0]
+			buf.WriteString(" " + c.text)
+		}
+		for _, c := range c.out {
+			write(c, indent+d.unit)
+		}
+	}
+
+	indent := d.indent(i)
+	for _, c := range root.out {
+		write(c, indent)
+	}
+	text := buf.String()[len(d.nl+indent):]
+	return edit{it[0].from, it[len(it)-1].to, text}, true
+}
+
+// subtreeEnd returns the end of the last line that belongs to a node that
+// starts a line: those that follow with more indentation (the subnodes).
+func (d *Document) subtreeEnd(n *Graph) int {
+	k := len(d.indent(d.start(n)))
+	end := d.lineEnd(d.chainEnd(n))
+
+	for i := end; i < len(d.src); {
+		// Start of the next line
+		i = bytes.IndexByte(d.src[i:], '\n') + i + 1
+		if i == 0 {
+			break
+		}
+
+		j := i
+		for j < len(d.src) && IsSpaceChar(d.src[j]) {
+			j++
+		}
+		e := d.lineEnd(j)
+		if e == j {
+			continue // Blank line
+		}
+		if j-i <= k {
+			break
+		}
+		end = e
+		i = e
+	}
+	return end
+}
+
+// lineHead returns true if the node is the first one in its line.
+func (d *Document) lineHead(n *Graph) bool {
+	i := d.start(n)
+	s := strings.TrimSpace(string(d.src[d.lineStart(i):i]))
+	return s == "" || isAnchor(s)
+}
+
+// isAnchor returns true for anchors, as '-{1}'.
+func isAnchor(s string) bool {
+	return s != "" && s[0] == '-' && isReference(s)
+}
+
+// lineStart returns the offset of the line that contains offset i.
+func (d *Document) lineStart(i int) int {
+	return bytes.LastIndexByte(d.src[:i], '\n') + 1
+}
+
+// lineEnd returns the offset of the line break that ends the line that
+// contains offset i, or the length of the text.
+func (d *Document) lineEnd(i int) int {
+	j := bytes.IndexByte(d.src[i:], '\n')
+	if j < 0 {
+		return len(d.src)
+	}
+	j += i
+	if j > i && d.src[j-1] == '\r' {
+		j--
+	}
+	return j
+}
+
+// indent returns the indentation of the line that contains offset i.
+func (d *Document) indent(i int) string {
+	j := d.lineStart(i)
+	k := j
+	for k < len(d.src) && IsSpaceChar(d.src[k]) {
+		k++
+	}
+	return string(d.src[j:k])
+}
+
+// childIndent returns the indentation for a new subnode of n in a new line.
+func (d *Document) childIndent(n *Graph) string {
+	for _, c := range n.Out {
+		if d.pos.Pos(c).IsValid() && d.lineHead(c) {
+			return d.indent(d.start(c))
+		}
+	}
+	if n == d.g {
+		return ""
+	}
+	return d.indent(d.start(n)) + d.unit
+}
+
+// indentUnit returns the first increment of indentation found in the text,
+// or two spaces.
+func (d *Document) indentUnit() string {
+	prev := ""
+	for _, line := range strings.Split(string(d.src), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		ind := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if len(ind) > len(prev) && strings.HasPrefix(ind, prev) {
+			return ind[len(prev):]
+		}
+		prev = ind
+	}
+	return "  "
+}
+
+// render writes a node and its subnodes, each in one line.
+func (d *Document) render(buf *bytes.Buffer, g *Graph, indent string, r *refs) {
+	name, done := r.visit(g)
+	if done {
+		buf.WriteString(d.nl + indent + "+{" + name + "}")
+		return
+	}
+	buf.WriteString(d.nl + indent)
+	if name != "" {
+		buf.WriteString("-{" + name + "} ")
+	}
+	buf.WriteString(d.scalar(g.This, indent))
+	for _, c := range g.Out {
+		d.render(buf, c, indent+d.unit, r)
+	}
+}
+
+// scalar returns the text of a value, quoted if needed. Quoted strings with
+// line breaks continue with the given indentation.
+func (d *Document) scalar(v interface{}, indent string) string {
+	s := _string(v)
+	if s != "" && !strings.ContainsAny(s, "\n\r \t'\"(),") && !isReference(s) && s[0] != '#' && s != "\\" {
+		return s
+	}
+
+	q := "\""
+	if strings.Contains(s, "\"") && !strings.Contains(s, "'") {
+		q = "'"
+	} else {
+		s = strings.Replace(s, "\"", "\\\"", -1)
+	}
+	s = strings.Replace(s, "\r", "", -1)
+	s = strings.Replace(s, "\n", d.nl+indent, -1)
+	return q + s + q
+}
+
+// tokenEnd returns the end of the scalar that begins at src[i], in a line
+// with the given indentation and inside the given number of groups. It
+// follows the rules of Lexer.Quoted, Lexer.Block and Lexer.word.
+func tokenEnd(src []byte, i, ind, depth int) int {
+	if i >= len(src) {
+		return i
+	}
+
+	switch c1 := src[i]; c1 {
+	case '"', '\'', '`':
+		var c2 byte
+		for i++; i < len(src); i++ {
+			c := src[i]
+			if IsEndChar(c) {
+				return i
+			}
+			if c == c1 && (c1 == '`' || c2 != '\\') {
+				return i + 1
+			}
+			if c == '\\' {
+				c2 = c
+				continue
+			}
+			if c == '\n' {
+				n := 0
+				for i+1 < len(src) && n < ind && IsSpaceChar(src[i+1]) {
+					i++
+					n++
+				}
+				if n < ind {
+					return i - n
+				}
+			}
+			c2 = c
+		}
+		return i
+
+	case '\\':
+		j := i + 1
+		if j < len(src) && src[j] == '\r' {
+			j++
+		}
+		if j >= len(src) || src[j] != '\n' {
+			break
+		}
+		end := i + 1
+		for j++; j < len(src); {
+			k := j
+			for k < len(src) && IsSpaceChar(src[k]) {
+				k++
+			}
+			if k-j <= ind || strings.Contains(string(src[j:k]), " ") && strings.Contains(string(src[j:k]), "\t") {
+				break
+			}
+			e := bytes.IndexByte(src[k:], '\n')
+			if e < 0 {
+				return len(src)
+			}
+			end = k + e
+			if src[end-1] == '\r' {
+				end--
+			}
+			j = k + e + 1
+		}
+		return end
+	}
+
+	for i < len(src) && IsTextChar(src[i]) {
+		if src[i] == ')' && depth > 0 {
+			break
+		}
+		if src[i] == ',' && (i+1 == len(src) || !IsTextChar(src[i+1]) || src[i+1] == ')' && depth > 0) {
+			break
+		}
+		i++
+	}
+	return i
+}
@@ -0,0 +1,173 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"testing"
+)
+
+const docText = `# Network configuration
+
+eth0
+  ip   192.168.1.10   # fixed
+  mask 255.255.255.0
+
+  gw 'router one'
+
+eth1 dhcp
+desc \
+  Some text
+  in a block
+`
+
+func TestDocument(t *testing.T) {
+
+	var tests = []struct {
+		op   string
+		path string
+		v    interface{}
+		out  string
+	}{
+		{"set", "eth0.ip", "10.0.0.1", "# Network configuration\n\neth0\n  ip   10.0.0.1   # fixed\n  mask 255.255.255.0\n\n  gw 'router one'\n\neth1 dhcp\ndesc \\\n  Some text\n  in a block\n"},
+		{"set", "eth0.gw", "router two", "# Network configuration\n\neth0\n  ip   192.168.1.10   # fixed\n  mask 255.255.255.0\n\n  gw \"router two\"\n\neth1 dhcp\ndesc \\\n  Some text\n  in a block\n"},
+		{"set", "eth1", 5, "# Network configuration\n\neth0\n  ip   192.168.1.10   # fixed\n  mask 255.255.255.0\n\n  gw 'router one'\n\neth1 5\ndesc \\\n  Some text\n  in a block\n"},
+		{"set", "eth0", "off", "# Network configuration\n\neth0 off\n\neth1 dhcp\ndesc \\\n  Some text\n  in a block\n"},
+		{"set", "eth0.mtu", 1500, "# Network configuration\n\neth0\n  ip   192.168.1.10   # fixed\n  mask 255.255.255.0\n\n  gw 'router one'\n  mtu 1500\n\neth1 dhcp\ndesc \\\n  Some text\n  in a block\n"},
+		{"set", "eth2.ip", "10.0.0.2", docText + "eth2 ip 10.0.0.2\n"},
+		{"add", "eth1", "static", "# Network configuration\n\neth0\n  ip   192.168.1.10   # fixed\n  mask 255.255.255.0\n\n  gw 'router one'\n\neth1 dhcp\n  static\ndesc \\\n  Some text\n  in a block\n"},
+		{"add", "eth1.dhcp", "yes", "# Network configuration\n\neth0\n  ip   192.168.1.10   # fixed\n  mask 255.255.255.0\n\n  gw 'router one'\n\neth1 dhcp yes\ndesc \\\n  Some text\n  in a block\n"},
+		{"add", "desc", "x", "# Network configuration\n\neth0\n  ip   192.168.1.10   # fixed\n  mask 255.255.255.0\n\n  gw 'router one'\n\neth1 dhcp\ndesc \\\n  Some text\n  in a block\n  x\n"},
+		{"delete", "eth0.mask", nil, "# Network configuration\n\neth0\n  ip   192.168.1.10   # fixed\n\n  gw 'router one'\n\neth1 dhcp\ndesc \\\n  Some text\n  in a block\n"},
+		{"delete", "eth0", nil, "# Network configuration\n\n\neth1 dhcp\ndesc \\\n  Some text\n  in a block\n"},
+		{"delete", "eth1.dhcp", nil, "# Network configuration\n\neth0\n  ip   192.168.1.10   # fixed\n  mask 255.255.255.0\n\n  gw 'router one'\n\neth1\ndesc \\\n  Some text\n  in a block\n"},
+		{"delete", "desc", nil, "# Network configuration\n\neth0\n  ip   192.168.1.10   # fixed\n  mask 255.255.255.0\n\n  gw 'router one'\n\neth1 dhcp\n"},
+	}
+
+	for _, test := range tests {
+		d, err := ParseDocument([]byte(docText))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch test.op {
+		case "set":
+			err = d.Set(test.path, test.v)
+		case "add":
+			err = d.Add(test.path, test.v)
+		case "delete":
+			err = d.Delete(test.path)
+		}
+
+		if err != nil {
+			t.Error(test.op, test.path, err)
+			continue
+		}
+		if d.String() != test.out {
+			t.Errorf("%s %s:\n%q\nexpected:\n%q", test.op, test.path, d.String(), test.out)
+		}
+	}
+}
+
+func TestDocumentSplit(t *testing.T) {
+
+	d, err := ParseDocument([]byte("a b c\nd\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Add("a.b", "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.String() != "a\n  b c\n    e\nd\n" || d.Get("a.b").Len() != 2 {
+		t.Errorf("%q", d.String())
+	}
+
+	// Subnodes are written with the line breaks of the document
+	d, _ = ParseDocument([]byte("a b c\r\nd\r\n"))
+	err = d.Set("a", FromString("x\n  y\nz"))
+	if err != nil || d.String() != "a\r\n  x\r\n    y\r\n  z\r\nd\r\n" {
+		t.Errorf("%q %v", d.String(), err)
+	}
+
+	if d.Get("x") != nil {
+		t.Error("Get of a missing path should return nil")
+	}
+
+	// Invalid edits are rejected, leaving the text unchanged
+	d, _ = ParseDocument([]byte("a\n  -{1} b\n    c\nd\n  +{1}\n"))
+	if d.Delete("a.b") == nil {
+		t.Error("deleting an anchored node should fail")
+	}
+	if d.String() != "a\n  -{1} b\n    c\nd\n  +{1}\n" {
+		t.Errorf("%q", d.String())
+	}
+}
+
+func TestDocumentFlow(t *testing.T) {
+
+	var tests = []struct {
+		in   string
+		op   string
+		path string
+		v    interface{}
+		out  string
+	}{
+		{"a b, c d\n", "delete", "a", nil, "c d\n"},
+		{"a b, c d\n", "delete", "c", nil, "a b\n"},
+		{"a b, c d\n", "delete", "a.b", nil, "a, c d\n"},
+		{"a b, -{1} c d\ne +{1}\n", "delete", "a", nil, "-{1} c d\ne +{1}\n"},
+		{"a (b c, d e)\n", "delete", "a.b", nil, "a (d e)\n"},
+		{"a (b c, d e)\n", "delete", "a.d", nil, "a (b c)\n"},
+		{"a (b) c, d\n", "delete", "a.b", nil, "a c, d\n"},
+		{"a (b) c, d\n", "delete", "a.c", nil, "a (b), d\n"},
+		{"a b, c d\n", "set", "a", 1, "a 1, c d\n"},
+		{"a (b c, d e)\n", "set", "a.d", 1, "a (b c, d 1)\n"},
+		{"a (b c, d e)\n", "set", "a", 1, "a 1\n"},
+		{"a (b c, d e)\n", "set", "a.d", FromString("x\ny"), "a\n  b c\n  d\n    x\n    y\n"},
+		{"a b, c d\n  e\n", "set", "a", FromString("x"), "a\n  x\nc d\n  e\n"},
+		{"a, c d\n", "add", "a", 1, "a 1, c d\n"},
+		{"a b, c d\n", "add", "a", 1, "a b\n  1\nc d\n"},
+		{"x (a, b c)\n  f\n", "add", "x.b", 1, "x\n  a\n  b c\n    1\n  f\n"},
+	}
+
+	for _, test := range tests {
+		d, err := ParseDocument([]byte(test.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch test.op {
+		case "set":
+			err = d.Set(test.path, test.v)
+		case "add":
+			err = d.Add(test.path, test.v)
+		case "delete":
+			err = d.Delete(test.path)
+		}
+
+		if err != nil {
+			t.Error(test.op, test.in, test.path, err)
+			continue
+		}
+		if d.String() != test.out {
+			t.Errorf("%s %q %s:\n%q\nexpected:\n%q", test.op, test.in, test.path, d.String(), test.out)
+		}
+	}
+
+	// Lines without flow syntax have the same graph
+	d, _ := ParseDocument([]byte("a (b c, d e), f\n  g\n"))
+	want := d.Graph().Text()
+	if err := d.Add("a.b", "c2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("a.b.c2"); err != nil {
+		t.Fatal(err)
+	}
+	if s := d.Graph().Text(); s != want || d.String() != "a\n  b c\n  d e\nf\n  g\n" {
+		t.Errorf("%q\n%s", d.String(), s)
+	}
+}
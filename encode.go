@@ -0,0 +1,330 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Marshaler is implemented by types that convert themselves to a graph. The
+// subnodes of the graph returned are the content of the value, as with
+// Marshal.
+type Marshaler interface {
+	MarshalOGDL() (*Graph, error)
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// Marshal converts a Go value to a graph, following the same rules as
+// Graph.Decode, so that Unmarshal(Marshal(v)) gives back v:
+//
+// - Structs have a subnode per field, named as in the ogdl tag or else as the
+// field. Fields tagged with omitempty are omitted if they are empty.
+// - Maps have a subnode per key, sorted.
+// - Slices and arrays have a subnode per element. Elements that are not
+// scalars are written under a '_' node.
+// - Scalars are a single subnode. Integers and floats are converted to int64
+// and float64 (unsigned integers beyond the range of int64, to text), while
+// time.Time and time.Duration are kept as they are.
+//
+// Types that implement Marshaler or encoding.TextMarshaler convert themselves.
+// Pointers and interfaces are followed, and nil values have no subnodes.
+func Marshal(v interface{}) (*Graph, error) {
+	g := New("_")
+	m := marshaler{make(map[visit]bool)}
+	err := m.encode(g, reflect.ValueOf(v), "")
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// EncodeError is returned by Marshal when a Go value cannot be converted.
+// Path is the path of the value, as in eth0.hosts[1].
+type EncodeError struct {
+	Path string
+	Type reflect.Type // The Go type of the value, if relevant
+	Err  error
+}
+
+// Error returns the error in the form path: message (type)
+func (e *EncodeError) Error() string {
+	s := e.Err.Error()
+	if e.Type != nil {
+		s += " (" + e.Type.String() + ")"
+	}
+	if e.Path != "" {
+		s = e.Path + ": " + s
+	}
+	return s
+}
+
+// Unwrap returns the underlying error.
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// marshaler holds the pointers, maps and slices being followed, to detect
+// cycles.
+type marshaler struct {
+	path map[visit]bool
+}
+
+// visit identifies a value being followed. Slices also need their length,
+// because slices of the same array with a different length are different
+// values.
+type visit struct {
+	ptr uintptr
+	len int
+}
+
+// enter marks a value as being followed. It returns an error if it already
+// is, and else a function that unmarks it.
+func (m marshaler) enter(v visit, path string) (func(), error) {
+	if m.path[v] {
+		return nil, &EncodeError{path, nil, ErrCycle}
+	}
+	m.path[v] = true
+	return func() { delete(m.path, v) }, nil
+}
+
+// encode adds the content of rv to n.
+func (m marshaler) encode(n *Graph, rv reflect.Value, path string) error {
+
+	if !rv.IsValid() {
+		return nil
+	}
+
+	t := rv.Type()
+
+	switch {
+	case t == graphType:
+		if !rv.IsNil() {
+			n.AddNodes(rv.Interface().(*Graph))
+		}
+		return nil
+
+	case t == timeType || t == durationType:
+		n.Add(rv.Interface())
+		return nil
+	}
+
+	if iv, ok := implements(rv, marshalerType); ok {
+		g, err := iv.Interface().(Marshaler).MarshalOGDL()
+		if err != nil {
+			return &EncodeError{path, nil, err}
+		}
+		n.AddNodes(g)
+		return nil
+	}
+
+	if iv, ok := implements(rv, textMarshalerType); ok {
+		b, err := iv.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return &EncodeError{path, nil, err}
+		}
+		n.Add(string(b))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		leave, err := m.enter(visit{rv.Pointer(), -1}, path)
+		if err != nil {
+			return err
+		}
+		defer leave()
+		return m.encode(n, rv.Elem(), path)
+
+	case reflect.Interface:
+		return m.encode(n, rv.Elem(), path)
+
+	case reflect.Struct:
+		for _, f := range fields(t) {
+			fv, ok := fieldValue(rv, f.index)
+			if !ok || (f.omitEmpty && isEmpty(fv)) {
+				continue
+			}
+			if err := m.encode(n.Add(f.name), fv, join(path, f.name)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		leave, err := m.enter(visit{rv.Pointer(), -1}, path)
+		if err != nil {
+			return err
+		}
+		defer leave()
+
+		keys := rv.MapKeys()
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = fmt.Sprint(k.Interface())
+		}
+		sort.Sort(byName{names, keys})
+
+		for i, k := range keys {
+			if err := m.encode(n.Add(names[i]), rv.MapIndex(k), join(path, names[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && rv.Kind() == reflect.Slice {
+			if !rv.IsNil() {
+				n.Add(append([]byte(nil), rv.Bytes()...))
+			}
+			return nil
+		}
+		if rv.Kind() == reflect.Slice && rv.Len() > 0 {
+			leave, err := m.enter(visit{rv.Pointer(), rv.Len()}, path)
+			if err != nil {
+				return err
+			}
+			defer leave()
+		}
+		for i := 0; i < rv.Len(); i++ {
+			e := rv.Index(i)
+			p := path + "[" + strconv.Itoa(i) + "]"
+			if isScalar(e) {
+				if err := m.encode(n, e, p); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := m.encode(n.Add("_"), e, p); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.String:
+		n.Add(rv.String())
+	case reflect.Bool:
+		n.Add(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n.Add(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		// Beyond the range of int64, as text
+		if u := rv.Uint(); u > math.MaxInt64 {
+			n.Add(strconv.FormatUint(u, 10))
+		} else {
+			n.Add(int64(u))
+		}
+	case reflect.Float32, reflect.Float64:
+		n.Add(rv.Float())
+	default:
+		return &EncodeError{path, t, ErrIncompatibleType}
+	}
+	return nil
+}
+
+// implements returns the value, or its address, if it implements the given
+// interface and is not a nil pointer.
+func implements(rv reflect.Value, it reflect.Type) (reflect.Value, bool) {
+	t := rv.Type()
+	if t.Implements(it) {
+		return rv, t.Kind() != reflect.Ptr || !rv.IsNil()
+	}
+	if rv.CanAddr() && reflect.PtrTo(t).Implements(it) {
+		return rv.Addr(), true
+	}
+	return rv, false
+}
+
+// isScalar returns true if the value is written as a single node.
+func isScalar(rv reflect.Value) bool {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return true
+		}
+		rv = rv.Elem()
+	}
+
+	t := rv.Type()
+	if t == timeType || t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return true
+	}
+	if t.Implements(marshalerType) || t == graphType.Elem() {
+		return false
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Array:
+		return false
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return true
+}
+
+// isEmpty returns true for the values omitted by omitempty: zero numbers,
+// false, nil, and empty strings, slices and maps.
+func isEmpty(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	case reflect.Struct:
+		return rv.IsZero()
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	}
+	return false
+}
+
+// fieldValue returns a field, or false if it is inside a nil embedded
+// pointer.
+func fieldValue(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return rv, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+// byName sorts map keys by their string form.
+type byName struct {
+	names []string
+	keys  []reflect.Value
+}
+
+func (b byName) Len() int           { return len(b.names) }
+func (b byName) Less(i, j int) bool { return b.names[i] < b.names[j] }
+func (b byName) Swap(i, j int) {
+	b.names[i], b.names[j] = b.names[j], b.names[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
@@ -0,0 +1,107 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"errors"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testPoint struct{ X, Y int }
+
+func (p testPoint) MarshalOGDL() (*Graph, error) {
+	g := New("_")
+	g.Add(int64(p.X))
+	g.Add(int64(p.Y))
+	return g, nil
+}
+
+func TestMarshal(t *testing.T) {
+
+	c := testConfig{
+		testBase: testBase{Debug: true},
+		Timeout:  30 * time.Second,
+		IP:       net.ParseIP("10.0.0.1"),
+		Hosts:    []string{"a", "b"},
+		Servers:  []*testHost{{"x", 1}, {"y", 2}},
+		Main:     testHost{Name: "z"},
+		Labels:   map[string]string{"zone": "eu", "env": "prod"},
+		Any:      "7",
+	}
+
+	g, err := Marshal(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `Debug true
+timeout 30s
+ip 10.0.0.1
+hosts (a, b)
+servers (_ (Name x, port 1), _ (Name y, port 2))
+main (Name z, port 0)
+labels (env prod, zone eu)
+extra
+any 7`
+	if s := g.TextFlow(80); s != want {
+		t.Errorf("got\n%s\nwant\n%s", s, want)
+	}
+
+	var c2 testConfig
+	if err = Unmarshal(g, &c2); err != nil {
+		t.Fatal(err)
+	}
+	c2.Extra = nil // A *Graph field receives its node, even if empty
+	if !reflect.DeepEqual(c, c2) {
+		t.Errorf("round trip: got %+v\nwant %+v", c2, c)
+	}
+
+	g, _ = Marshal(map[string]interface{}{"p": testPoint{1, 2}, "n": 1.5})
+	if s := g.TextFlow(80); s != "n 1.5\np (1, 2)" {
+		t.Error("Marshaler", s)
+	}
+
+	type node struct{ Next *node }
+	n := &node{}
+	n.Next = n
+	if _, err = Marshal(n); !errors.Is(err, ErrCycle) {
+		t.Error("cycle", err)
+	}
+
+	m := map[string]interface{}{}
+	m["m"] = m
+	var eerr *EncodeError
+	if _, err = Marshal(m); !errors.As(err, &eerr) || eerr.Path != "m" || !errors.Is(err, ErrCycle) {
+		t.Error("map cycle", err)
+	}
+	s := []interface{}{nil}
+	s[0] = s
+	if _, err = Marshal(s); !errors.Is(err, ErrCycle) {
+		t.Error("slice cycle", err)
+	}
+
+	// The same map twice is not a cycle
+	a := map[string]int{"a": 1}
+	if _, err = Marshal([]interface{}{a, a}); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = Marshal(make(chan int)); err == nil || err.Error() != "incompatible type (chan int)" {
+		t.Error("error at the root", err)
+	}
+
+	var u struct{ U uint64 }
+	g, _ = Marshal(struct{ U uint64 }{math.MaxUint64})
+	if s := g.Text(); s != "U\n  18446744073709551615" {
+		t.Error("uint64", s)
+	}
+	if err = Unmarshal(g, &u); err != nil || u.U != math.MaxUint64 {
+		t.Error("uint64 round trip", u.U, err)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// QuoteStyle selects the quotes used for strings that need them.
+type QuoteStyle int
+
+const (
+	// QuoteDouble uses "", or '' if the string has " but not '
+	QuoteDouble QuoteStyle = iota
+	// QuoteSingle uses '', or "" if the string has ' but not "
+	QuoteSingle
+)
+
+// Encoder writes graphs as OGDL text to an io.Writer. The fields control the
+// layout, and can be changed before calling Encode. The zero value of each
+// field gives the same layout as Graph.Text(), except for quoting, that is
+// done only where needed. Nil values are written as null (see ResolveNull).
+//
+//	e := ogdl.NewEncoder(os.Stdout)
+//	e.Chain = true
+//	err := e.Encode(g)
+type Encoder struct {
+	Indent int        // Spaces per level (0 means 2)
+	Tabs   bool       // Indent with tabs instead of spaces
+	Blocks bool       // Write multiline leaf strings as \ blocks
+	Chain  bool       // Write single-child nodes in one line, as in 'ip 192.168.1.1'
+	Flow   bool       // Write subtrees in one line using the flow syntax, as in 'a (b, c)'
+	Width  int        // Maximum line width for Chain and Flow (0 means no limit)
+	Quote  QuoteStyle // Quotes for strings with spaces and other special characters
+
+	w *bufio.Writer
+	r *refs
+}
+
+// NewEncoder returns an Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{Indent: 2, w: bufio.NewWriter(w)}
+}
+
+// Encode writes the subnodes of g (not g itself, as Text()), followed by a
+// line break.
+func (e *Encoder) Encode(g *Graph) error {
+	if g == nil {
+		return nil
+	}
+
+	// The root is not written, so it cannot have an anchor (see Text).
+	e.r = newRefs(g)
+	e.r.visit(g)
+
+	for _, n := range g.Out {
+		e.node(n, 0)
+	}
+	return e.w.Flush()
+}
+
+// node writes a node and its subnodes.
+func (e *Encoder) node(g *Graph, level int) {
+
+	sp := e.indent(level)
+
+	name, done := e.r.visit(g)
+	if done {
+		e.w.WriteString(sp + "+{" + name + "}\n")
+		return
+	}
+
+	line := sp
+	if name != "" {
+		line += "-{" + name + "} "
+	}
+
+	if e.Flow {
+		if s, ok := e.flow(g, e.max(line)); ok {
+			e.w.WriteString(line + s + "\n")
+			return
+		}
+	}
+
+	if e.Chain {
+		if s, ok := e.chain(g, e.max(line)); ok {
+			e.w.WriteString(line + s + "\n")
+			return
+		}
+	}
+
+	if g.Len() == 0 && e.block(g) {
+		e.w.WriteString(line)
+		e.writeBlock(g, level)
+		return
+	}
+
+	e.w.WriteString(line + e.token(g, sp))
+
+	// A multiline leaf as a block in the same line: 'a \'
+	if g.Len() == 1 && g.Out[0].Len() == 0 && e.block(g.Out[0]) && !e.shared(g.Out[0]) {
+		e.w.WriteByte(' ')
+		e.writeBlock(g.Out[0], level)
+		return
+	}
+
+	e.w.WriteByte('\n')
+	for _, n := range g.Out {
+		e.node(n, level+1)
+	}
+}
+
+// chain returns the node and its subnodes in one line, if they form a
+// single path of nodes with one subnode each, and fit in max bytes.
+func (e *Encoder) chain(g *Graph, max int) (string, bool) {
+	var tokens []string
+
+	for n := g; ; n = n.Out[0] {
+		if n != g && e.shared(n) {
+			return "", false
+		}
+		s := e.token(n, "")
+		if strings.ContainsAny(s, "\r\n") {
+			return "", false
+		}
+		tokens = append(tokens, s)
+
+		if n.Len() == 0 {
+			break
+		}
+		if n.Len() != 1 {
+			return "", false
+		}
+	}
+
+	s := strings.Join(tokens, " ")
+	return s, len(tokens) > 1 && len(s) <= max
+}
+
+// flow returns the subtree in flow syntax, as in 'a (b c, d)', or false if
+// it doesn't fit in max bytes or cannot be written in one line.
+func (e *Encoder) flow(g *Graph, max int) (string, bool) {
+
+	if e.shared(g) {
+		return "", false
+	}
+	s := e.token(g, "")
+	if len(s) > max || strings.ContainsAny(s, "\r\n") {
+		return "", false
+	}
+
+	switch len(g.Out) {
+	case 0:
+		return s, true
+	case 1:
+		t, ok := e.flow(g.Out[0], max-len(s)-1)
+		return s + " " + t, ok
+	}
+
+	s += " ("
+	for i, n := range g.Out {
+		if i > 0 {
+			s += ", "
+		}
+		t, ok := e.flow(n, max-len(s)-1)
+		if !ok {
+			return "", false
+		}
+		s += t
+	}
+	s += ")"
+
+	return s, len(s) <= max
+}
+
+// shared returns true if the node has an anchor, and cannot be written in a
+// chain or flow sequence.
+func (e *Encoder) shared(g *Graph) bool {
+	if e.r == nil {
+		return false
+	}
+	_, ok := e.r.names[g]
+	return ok
+}
+
+// block returns true if the node is written as a block.
+func (e *Encoder) block(g *Graph) bool {
+	if !e.Blocks || g == nil {
+		return false
+	}
+	s, ok := g.This.(string)
+	if !ok || !strings.Contains(s, "\n") || strings.HasSuffix(s, "\n") {
+		return false
+	}
+
+	// Blocks cannot hold empty lines, leading space or CR's
+	for _, l := range strings.Split(s, "\n") {
+		if l == "" || IsSpaceChar(l[0]) || strings.ContainsAny(l, "\r") {
+			return false
+		}
+	}
+	return true
+}
+
+// writeBlock writes a '\', and the lines of the string of g one level
+// deeper than the given one.
+func (e *Encoder) writeBlock(g *Graph, level int) {
+	sp := e.indent(level + 1)
+	e.w.WriteString("\\\n")
+	for _, l := range strings.Split(g.This.(string), "\n") {
+		e.w.WriteString(sp + l + "\n")
+	}
+}
+
+// token returns the value of a node, quoted if needed. Line breaks in
+// quoted strings are followed by the given indentation.
+func (e *Encoder) token(g *Graph, sp string) string {
+	if g == nil {
+		return "_"
+	}
+	if g.This == nil {
+		return "null"
+	}
+
+	s := _string(g.This)
+	if !needsQuotes(s) {
+		return s
+	}
+
+	q := byte('"')
+	if e.Quote == QuoteSingle {
+		q = '\''
+	}
+	if strings.IndexByte(s, q) >= 0 {
+		other := byte('"' + '\'' - q)
+		if strings.IndexByte(s, other) < 0 {
+			q = other
+		}
+	}
+
+	buf := []byte{q}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\r':
+			continue
+		case '\n':
+			buf = append(buf, '\n')
+			buf = append(buf, sp...)
+			continue
+		case q:
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, c)
+	}
+	return string(append(buf, q))
+}
+
+// needsQuotes returns true if a string cannot be written as is in OGDL text.
+func needsQuotes(s string) bool {
+	if s == "" || s == "\\" || isReference(s) {
+		return true
+	}
+	switch s[0] {
+	case '"', '\'', '`', '#', '(':
+		return true
+	}
+	return strings.ContainsAny(s, " \t\r\n,)")
+}
+
+// indent returns the indentation of the given level.
+func (e *Encoder) indent(level int) string {
+	if e.Tabs {
+		return strings.Repeat("\t", level)
+	}
+	n := e.Indent
+	if n <= 0 {
+		n = 2
+	}
+	return strings.Repeat(" ", n*level)
+}
+
+// max returns the room left in a line after the given prefix, for Chain and
+// Flow.
+func (e *Encoder) max(prefix string) int {
+	if e.Width <= 0 {
+		return int(^uint(0) >> 1)
+	}
+	return e.Width - len(prefix)
+}
@@ -0,0 +1,49 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+
+	g := New("_")
+	eth := g.Add("eth0")
+	eth.Add("ip").Add("192.168.1.1")
+	eth.Add("desc").Add("first line\nsecond line")
+	eth.Add("name").Add("it's \"the\" one")
+	g.Add("dns").Add("a, b")
+
+	cases := []struct {
+		setup func(e *Encoder)
+		want  string
+	}{
+		{func(e *Encoder) {}, "eth0\n  ip\n    192.168.1.1\n  desc\n    \"first line\n    second line\"\n  name\n    \"it's \\\"the\\\" one\"\ndns\n  \"a, b\"\n"},
+		{func(e *Encoder) { e.Chain = true; e.Blocks = true }, "eth0\n  ip 192.168.1.1\n  desc \\\n    first line\n    second line\n  name \"it's \\\"the\\\" one\"\ndns \"a, b\"\n"},
+		{func(e *Encoder) { e.Chain = true; e.Width = 10 }, "eth0\n  ip\n    192.168.1.1\n  desc\n    \"first line\n    second line\"\n  name\n    \"it's \\\"the\\\" one\"\ndns \"a, b\"\n"},
+		{func(e *Encoder) { e.Tabs = true; e.Quote = QuoteSingle }, "eth0\n\tip\n\t\t192.168.1.1\n\tdesc\n\t\t'first line\n\t\tsecond line'\n\tname\n\t\t'it\\'s \"the\" one'\ndns\n\t'a, b'\n"},
+		{func(e *Encoder) { e.Indent = 4; e.Flow = true; e.Width = 30 }, "eth0\n    ip 192.168.1.1\n    desc\n        \"first line\n        second line\"\n    name \"it's \\\"the\\\" one\"\ndns \"a, b\"\n"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			e := NewEncoder(&buf)
+			tc.setup(e)
+			if err := e.Encode(g); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", buf.String(), tc.want)
+			}
+			if g2 := FromString(buf.String()); !g.Equals(g2) {
+				t.Errorf("round trip:\n%s", g2.Show())
+			}
+		})
+	}
+}
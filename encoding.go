@@ -5,80 +5,116 @@
 package ogdl
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"io"
 	"math"
-	"strings"
+	"strconv"
+	"unicode/utf8"
 )
 
-// FromJSON converts a JSON text stream into OGDL.
+// FromJSON converts a JSON text into a graph. The root node ('_') holds the
+// JSON value, as follows:
 //
-// Json types returned by Decode/Unmarshall:
-// - bool, for JSON booleans
-// - int64 / float64, for JSON numbers
-// - string, for JSON strings
-// - []interface{}, for JSON arrays
-// - map[string]interface{}, for JSON objects
-// - nil for JSON null
+// - Objects are a subnode per key, in the order of the text, each holding
+// the value of the key.
+// - Arrays are a '_' node with a subnode per element.
+// - Objects that are elements of an array are a '{}' node holding the keys.
+// An empty object is a '{}' leaf.
+// - Strings, numbers (int64 or float64) and booleans are leaf nodes, and null
+// is a leaf node with a nil value.
 //
-// TODO I'm not sure about not giving lists a root node, but we need to avoid both
-// useless nesting and also post-simplification (and its unwanted side effects).
-// But, for example [ "a", [ "b", "c" ] ] will be returned as:
-//     a
-//     b
-//     c
+// For example, {"a": [1, [2, 3], {"b": null}]} is converted to
 //
+//	a
+//	  _
+//	    1
+//	    _
+//	      2
+//	      3
+//	    {}
+//	      b
+//	        null
+//
+// and [ "a", [ "b", "c" ] ] keeps its nesting. Graph.JSON() reads back this
+// structure, so that FromJSON(x).JSON() gives x again. The exception are the
+// strings "_" and "{}", that are read back as an empty array and object.
 func FromJSON(buf []byte) (*Graph, error) {
 
-	var v interface{}
-
 	// Use Decoder, since we want to treat integers as integers.
 	dec := json.NewDecoder(bytes.NewReader(buf))
 	dec.UseNumber()
 
-	// We expect here only one map or list
-	err := dec.Decode(&v)
-	if err != nil {
+	g := New("_")
+	if err := jsonValue(dec, g, false); err != nil {
 		return nil, err
 	}
-
-	return toGraph(v).GetAt(0), nil
+	return g, nil
 }
 
-func toGraph(v interface{}) *Graph {
+// jsonValue reads a JSON value and adds it to g. If elem is true the value is
+// an element of an array, and an object has its own '{}' node.
+func jsonValue(dec *json.Decoder, g *Graph, elem bool) error {
 
-	g := New("_")
+	t, err := dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
 
-	switch v.(type) {
+	switch v := t.(type) {
+	case json.Delim:
+		if v == '[' {
+			l := g.Add("_")
+			for dec.More() {
+				if err := jsonValue(dec, l, true); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		}
 
-	case []interface{}:
-		// n := g.Add("_")
-		for _, i := range v.([]interface{}) {
-			g.Add(toGraph(i))
+		// An object. Its keys are added to g, unless it is an element of an
+		// array, is empty, or its only key is '_' or '{}'.
+		o := New("{}")
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if err := jsonValue(dec, o.Add(k), false); err != nil {
+				return err
+			}
+		}
+		if _, err = dec.Token(); err != nil {
+			return err
 		}
-	case map[string]interface{}:
-		n := g.Add("_")
-		for k, i := range v.(map[string]interface{}) {
-			n.Add(k).AddNodes(toGraph(i))
+
+		if elem || o.Len() == 0 || (o.Out[0].IsList() || o.Out[0].IsMap()) && o.Len() == 1 {
+			g.Add(o)
+		} else {
+			g.AddNodes(o)
 		}
 	case json.Number:
 		// try first to decode the number as an integer.
-		i, err := v.(json.Number).Int64()
-		if err != nil {
-			f, err := v.(json.Number).Float64()
-			if err != nil {
-				f = math.NaN()
-			}
+		if i, err := v.Int64(); err == nil {
+			g.Add(i)
+		} else if f, err := v.Float64(); err == nil {
 			g.Add(f)
 		} else {
-			g.Add(i)
+			g.Add(math.NaN())
 		}
-
+	case nil:
+		// Add(nil) does nothing
+		g.Add(New(nil))
 	default:
 		g.Add(v)
 	}
-	return g
+	return nil
 }
 
 // JSON produces JSON text from a Graph
@@ -90,97 +126,330 @@ func toGraph(v interface{}) *Graph {
 // map ::= '{' string ':' value [',' string : value]* '}'
 // list ::= '[' value [',' value]* ']'
 //
-// By definition, since maps and lists cannot be distinguished in OGDL, any list
-// should have a '_' root node.
-// Any non-leaf node is a map (unless is contains '_', obviously).
+// Since maps and lists cannot be distinguished in OGDL, the structure
+// produced by FromJSON is used: a '_' node is a list of its subnodes, and a
+// '{}' node a map. The value held by any other node is
+//
+// - null, if it has no subnodes,
+// - the value of its only subnode, if it is a leaf, '_' or '{}' node,
+// - else a map with a key per subnode.
 //
+// Non-leaf elements of a list, other than '_' and '{}', are maps with a
+// single key. Leaves are written according to their Go type, so that
+// strings are always quoted. Use a JSONEncoder for other options.
+//
+// JSON cannot represent shared nodes, so they are written at each occurrence.
+// A node that closes a cycle is written as a reference string, "+{name}".
 func (g *Graph) JSON() []byte {
 
 	if g == nil {
 		return nil
 	}
 
-	var buf *bytes.Buffer
-	buf = new(bytes.Buffer)
+	buf := new(bytes.Buffer)
+	NewJSONEncoder(buf).Encode(g)
 
-	// Temporarily set root to something different than _
-	i := g.This
-	g.This = ""
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
+}
 
-	g.json(buf)
+// JSONEncoder writes graphs as JSON to an io.Writer, following the rules of
+// Graph.JSON. The fields select other options, and can be changed before
+// calling Encode.
+//
+//	e := ogdl.NewJSONEncoder(w)
+//	e.Indent = "  "
+//	err := e.Encode(g)
+type JSONEncoder struct {
+	Indent string // Indentation of each level, as "  " (empty for compact output)
+	Arrays bool   // Write repeated keys of a map as one key holding a list
+	Typed  bool   // Write string leaves that are numbers, true, false or null unquoted
+	List   string // Name of the nodes that are lists (empty means "_")
 
-	// Restore root
-	g.This = i
+	w     *bufio.Writer
+	r     *refs
+	level int
+}
 
-	return buf.Bytes()
+// NewJSONEncoder returns a JSONEncoder that writes to w.
+func NewJSONEncoder(w io.Writer) *JSONEncoder {
+	return &JSONEncoder{w: bufio.NewWriter(w)}
 }
 
-func (g *Graph) json(buf *bytes.Buffer) {
+// Encode writes the value held by g (see Graph.JSON), followed by a line
+// break.
+func (e *JSONEncoder) Encode(g *Graph) error {
+	if g == nil {
+		return nil
+	}
+
+	e.r = newRefs(g)
+	e.r.enter(g)
+	e.level = 0
+
+	e.value(g)
+	e.w.WriteByte('\n')
+	return e.w.Flush()
+}
 
-	// If this is a leaf node, print it as value
-	if g.Len() == 0 {
-		g.writeValue(buf)
+// value writes the value held by g.
+func (e *JSONEncoder) value(g *Graph) {
+	switch {
+	case g.Len() == 0:
+		e.w.WriteString("null")
+	case g.Len() == 1 && (g.Out[0].Len() == 0 || e.isList(g.Out[0]) || g.Out[0].IsMap()):
+		e.element(g.Out[0])
+	default:
+		e.object(g.Out)
+	}
+}
+
+// element writes g as an element of a list.
+func (e *JSONEncoder) element(g *Graph) {
+	ref, ok := e.r.enter(g)
+	if !ok {
+		e.string(ref)
 		return
 	}
+	defer e.r.exit(g)
 
-	typ := 0
+	switch {
+	case e.isList(g):
+		e.list(g.Out)
+	case g.IsMap():
+		e.object(g.Out)
+	case g.Len() == 0:
+		e.leaf(g.This)
+	default:
+		e.object([]*Graph{g})
+	}
+}
 
-	// Now, it is either a map or a list
-	if g.ThisString() == "_" {
-		typ = '['
-		buf.WriteString("[ ")
-	} else if g.Len() > 1 {
-		typ = '{'
-		buf.WriteString("{ ")
+// list writes the nodes given as the elements of a list.
+func (e *JSONEncoder) list(nodes []*Graph) {
+	e.w.WriteByte('[')
+	e.level++
+	for i, n := range nodes {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		e.newline()
+		e.element(n)
 	}
+	e.level--
+	if len(nodes) > 0 {
+		e.newline()
+	}
+	e.w.WriteByte(']')
+}
+
+// object writes a map with the given nodes as keys. With Arrays, the nodes
+// with the same name are written once, with a list of their values.
+func (e *JSONEncoder) object(keys []*Graph) {
+	e.w.WriteByte('{')
+	e.level++
 
-	comma := false
+	done := make(map[string]bool)
 
-	for _, n := range g.Out {
-		if comma {
-			buf.WriteString(", ")
+	for i, n := range keys {
+		name := n.ThisString()
+		if done[name] {
+			continue
 		}
-		switch n.Len() {
-		case 0:
-			n.writeValue(buf)
-		case 1:
-			n.writeString(buf)
-			buf.WriteString(": ")
-			n.json(buf)
-			comma = true
-		default:
-			n.json(buf)
-			comma = true
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		e.newline()
+		e.string(name)
+		e.w.WriteByte(':')
+		if e.Indent != "" {
+			e.w.WriteByte(' ')
+		}
+
+		var same []*Graph
+		if e.Arrays {
+			for _, m := range keys[i:] {
+				if m.ThisString() == name {
+					same = append(same, m)
+				}
+			}
+			done[name] = true
+		}
+
+		if len(same) > 1 {
+			e.w.WriteByte('[')
+			e.level++
+			for j, m := range same {
+				if j > 0 {
+					e.w.WriteByte(',')
+				}
+				e.newline()
+				e.key(m)
+			}
+			e.level--
+			e.newline()
+			e.w.WriteByte(']')
+		} else {
+			e.key(n)
 		}
 	}
 
-	switch typ {
-	case '[':
-		buf.WriteByte(']')
-	case '{':
-		buf.WriteByte('}')
+	e.level--
+	if len(keys) > 0 {
+		e.newline()
 	}
+	e.w.WriteByte('}')
 }
 
-func (g *Graph) writeString(buf *bytes.Buffer) {
-	s := g.ThisString()
-	buf.WriteByte('"')
-	s = strings.Replace(s, "\"", "\\\"", -1)
-	buf.WriteString(s)
-	buf.WriteByte('"')
-	buf.WriteByte(' ')
+// key writes the value of a key of a map.
+func (e *JSONEncoder) key(n *Graph) {
+	ref, ok := e.r.enter(n)
+	if !ok {
+		e.string(ref)
+		return
+	}
+	e.value(n)
+	e.r.exit(n)
 }
 
-func (g *Graph) writeValue(buf *bytes.Buffer) {
-	n, ok := _int64(g.This)
-	if ok {
-		buf.WriteString(fmt.Sprintf("%d ", n))
+// leaf writes the value of a leaf node.
+func (e *JSONEncoder) leaf(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		e.w.WriteString("null")
+	case bool:
+		e.w.WriteString(strconv.FormatBool(v))
+	case float32:
+		e.float(float64(v), 32)
+	case float64:
+		e.float(v, 64)
+	case string:
+		if e.Typed && isJSONLiteral(v) {
+			e.w.WriteString(v)
+			return
+		}
+		e.string(v)
+	default:
+		if i, ok := _int64(v); ok {
+			e.w.WriteString(strconv.FormatInt(i, 10))
+			return
+		}
+		e.string(_string(v))
+	}
+}
+
+// float writes a number with the precision needed to read it back. NaN and
+// infinities are not valid JSON, and are written as null.
+func (e *JSONEncoder) float(f float64, bits int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		e.w.WriteString("null")
 		return
 	}
-	f, ok := _float64(g.This)
-	if ok {
-		buf.WriteString(fmt.Sprintf("%f ", f))
+	e.w.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+}
+
+// string writes a quoted JSON string.
+func (e *JSONEncoder) string(s string) {
+	const hex = "0123456789abcdef"
+
+	w := e.w
+	w.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				w.WriteString(`\ufffd`)
+			} else {
+				w.WriteString(s[i : i+size])
+			}
+			i += size
+			continue
+		}
+		switch c {
+		case '"', '\\':
+			w.WriteByte('\\')
+			w.WriteByte(c)
+		case '\n':
+			w.WriteString(`\n`)
+		case '\r':
+			w.WriteString(`\r`)
+		case '\t':
+			w.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				w.WriteString(`\u00`)
+				w.WriteByte(hex[c>>4])
+				w.WriteByte(hex[c&0xf])
+			} else {
+				w.WriteByte(c)
+			}
+		}
+		i++
+	}
+	w.WriteByte('"')
+}
+
+// newline starts a new line at the current level, if Indent is set.
+func (e *JSONEncoder) newline() {
+	if e.Indent == "" {
 		return
 	}
-	g.writeString(buf)
+	e.w.WriteByte('\n')
+	for i := 0; i < e.level; i++ {
+		e.w.WriteString(e.Indent)
+	}
+}
+
+// isList returns true for the nodes that stand for lists.
+func (e *JSONEncoder) isList(g *Graph) bool {
+	s, ok := g.This.(string)
+	if e.List == "" {
+		return ok && s == "_"
+	}
+	return ok && s == e.List
+}
+
+// IsList returns true for the '_' nodes, that FromJSON and the other
+// converters use for lists (arrays, sequences).
+func (g *Graph) IsList() bool {
+	if g == nil {
+		return false
+	}
+	s, ok := g.This.(string)
+	return ok && s == "_"
+}
+
+// IsMap returns true for the '{}' nodes, that FromJSON and the other
+// converters use for maps (objects, tables) that cannot be written as
+// subnodes of their parent.
+func (g *Graph) IsMap() bool {
+	if g == nil {
+		return false
+	}
+	s, ok := g.This.(string)
+	return ok && s == "{}"
+}
+
+// Content returns the node that stands for the value held by g: its only
+// subnode, if it is a leaf, a '_' or a '{}' node, or else g itself, whose
+// subnodes are the keys of a map. It returns nil if g has no subnodes.
+func (g *Graph) Content() *Graph {
+	switch {
+	case g.Len() == 0:
+		return nil
+	case g.Len() == 1 && (g.Out[0].Len() == 0 || g.Out[0].IsList() || g.Out[0].IsMap()):
+		return g.Out[0]
+	}
+	return g
+}
+
+// isJSONLiteral returns true if s is a JSON number, true, false or null.
+func isJSONLiteral(s string) bool {
+	switch s {
+	case "true", "false", "null":
+		return true
+	case "":
+		return false
+	}
+	return (s[0] == '-' || s[0] >= '0' && s[0] <= '9') && json.Valid([]byte(s))
 }
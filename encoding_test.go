@@ -0,0 +1,145 @@
+package ogdl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFromJSON(t *testing.T) {
+
+	var tests = []struct {
+		json string
+		text string
+	}{
+		{`{"b":1,"a":2}`, "b\n  1\na\n  2"},
+		{`["a",["b","c"]]`, "_\n  a\n  _\n    b\n    c"},
+		{`{"a":null}`, "a\n  null"},
+		{`[{"a":1},{}]`, "_\n  {}\n    a\n      1\n  {}"},
+		{`{"a":{"_":[]}}`, "a\n  {}\n    _\n      _"},
+	}
+
+	for _, tt := range tests {
+		g, err := FromJSON([]byte(tt.json))
+		if err != nil {
+			t.Error(tt.json, err)
+			continue
+		}
+		var b strings.Builder
+		NewEncoder(&b).Encode(g)
+		if s := strings.TrimSuffix(b.String(), "\n"); s != tt.text {
+			t.Errorf("%s: got\n%s", tt.json, s)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+
+	var tests = []string{
+		`{"z":1,"y":{"x":[1,2.5,-3e+100]},"a":"b"}`,
+		`[1,[2,[3,[]]],{"a":null},{}]`,
+		`{"a":{"b":{}},"c":[{"d":true,"e":false}]}`,
+		`{"only":{"one":"key"}}`,
+		`{"_":{"{}":1}}`,
+		`"a \"quoted\"\nstring\twith \\ and \u0001"`,
+		`{"a":"é ☺"}`,
+		`123456789012345678`,
+		`null`,
+		`{}`,
+		`[]`,
+	}
+
+	for _, s := range tests {
+		g, err := FromJSON([]byte(s))
+		if err != nil {
+			t.Error(s, err)
+			continue
+		}
+		if b := string(g.JSON()); b != s {
+			t.Errorf("got %s, expected %s", b, s)
+		}
+	}
+}
+
+func TestFromJSONError(t *testing.T) {
+	for _, s := range []string{``, `{"a":`, `[1,2`, `{"a" 1}`} {
+		if _, err := FromJSON([]byte(s)); err == nil {
+			t.Error("expected error:", s)
+		}
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+
+	var tests = []struct {
+		opts func(e *JSONEncoder)
+		in   string
+		json string
+	}{
+		{nil, "a 1\nb \"x\\\"\ny\"", `{"a":"1","b":"x\"\ny"}`},
+		{nil, "a\\b c", `{"a\\b":"c"}`},
+		{func(e *JSONEncoder) { e.Typed = true }, "a 1.5\nb true\nc null\nd 01\ne -", `{"a":1.5,"b":true,"c":null,"d":"01","e":"-"}`},
+		{func(e *JSONEncoder) { e.Arrays = true }, "a 1\nb 2\na (x 3)", `{"a":["1",{"x":"3"}],"b":"2"}`},
+		{nil, "a 1\na 2", `{"a":"1","a":"2"}`},
+		{func(e *JSONEncoder) { e.List = "list" }, "a (list (1, 2)), _ 3", `{"a":["1","2"],"_":"3"}`},
+		{func(e *JSONEncoder) { e.Indent = "  " }, "a (_ (1, {}))\nb", "{\n  \"a\": [\n    \"1\",\n    {}\n  ],\n  \"b\": null\n}"},
+	}
+
+	for _, tt := range tests {
+		var b strings.Builder
+		e := NewJSONEncoder(&b)
+		if tt.opts != nil {
+			tt.opts(e)
+		}
+		if err := e.Encode(FromString(tt.in)); err != nil {
+			t.Error(err)
+		}
+		if s := strings.TrimSuffix(b.String(), "\n"); s != tt.json {
+			t.Errorf("%q: got %s, expected %s", tt.in, s, tt.json)
+		}
+	}
+}
+
+func TestJSONValues(t *testing.T) {
+	g := New("_")
+	g.Add("f").Add(0.1)
+	g.Add("g").Add(float32(0.1))
+	g.Add("t").Add(false)
+	g.Add("n").Add(New(nil))
+	g.Add("i").Add(-7)
+
+	s := string(g.JSON())
+	if s != `{"f":0.1,"g":0.1,"t":false,"n":null,"i":-7}` {
+		t.Error(s)
+	}
+}
+
+func TestContent(t *testing.T) {
+	g, _ := FromJSON([]byte(`{"a":1,"b":[1,2],"c":{"x":1,"y":2},"d":[{"x":1}],"e":null}`))
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"a", "1"},
+		{"b", "_"},
+		{"c", "c"},
+		{"d", "_"},
+	}
+
+	for _, tt := range tests {
+		c := g.Node(tt.key).Content()
+		if c.ThisString() != tt.want {
+			t.Errorf("%s: got %s", tt.key, c.ThisString())
+		}
+	}
+
+	if c := g.Node("e").Content(); c == nil || c.This != nil {
+		t.Error("e: null")
+	}
+	if New("x").Content() != nil {
+		t.Error("a node without value")
+	}
+	if !g.Node("b").Content().IsList() || !g.Node("d").Content().Out[0].IsMap() || g.Node("c").IsMap() {
+		t.Error("IsList, IsMap")
+	}
+}
@@ -4,6 +4,8 @@
 
 package ogdl
 
+import "time"
+
 // import "log"
 
 // Eval takes a parsed expression and evaluates it
@@ -457,13 +459,55 @@ func (g *Graph) evalBinary(p *Graph) interface{} {
 	return nil
 }
 
-// int* | float* | string
+// int* | float* | string | time.Time | time.Duration
 // first element determines type
 func compare(v1, v2 interface{}, op int) bool {
 
 	var i1, i2 int64
 	var ok bool
 
+	// Times and durations (see RegisterScalar) are compared as such
+	switch v := v1.(type) {
+	case time.Time:
+		t, ok := _time(v2)
+		if !ok {
+			return false
+		}
+		c := 0
+		if v.Before(t) {
+			c = -1
+		} else if v.After(t) {
+			c = 1
+		}
+		return ordered(c, op)
+	case time.Duration:
+		d, ok := _duration(v2)
+		if !ok {
+			return false
+		}
+		c := 0
+		if v < d {
+			c = -1
+		} else if v > d {
+			c = 1
+		}
+		return ordered(c, op)
+	}
+	switch v2.(type) {
+	case time.Time, time.Duration:
+		switch op {
+		case '+':
+			op = '-'
+		case '-':
+			op = '+'
+		case '>':
+			op = '<'
+		case '<':
+			op = '>'
+		}
+		return compare(v2, v1, op)
+	}
+
 	i1, ok = _int64(v1)
 
 	if ok {
@@ -526,6 +570,26 @@ func compare(v1, v2 interface{}, op int) bool {
 	return false
 }
 
+// ordered returns the result of a comparison operator, given the sign of
+// the difference of the operands.
+func ordered(c int, op int) bool {
+	switch op {
+	case '=':
+		return c == 0
+	case '+':
+		return c >= 0
+	case '-':
+		return c <= 0
+	case '>':
+		return c > 0
+	case '<':
+		return c < 0
+	case '!':
+		return c != 0
+	}
+	return false
+}
+
 // logic: and / or
 func logic(i1, i2 interface{}, op int) bool {
 
@@ -581,8 +645,19 @@ func (g *Graph) assign(p *Graph, v interface{}, op int) interface{} {
 // - If any is float64, the other is converted to float64
 // - A numeric string is always converted to float64
 // - If both are strings, only '+' is supported (contactenation)
+// - time.Time and time.Duration follow the rules of the time package
 func calc(v1, v2 interface{}, op int) interface{} {
 
+	if v, ok := v1.(time.Time); ok {
+		return calcTime(v, v2, op)
+	}
+	if v, ok := v1.(time.Duration); ok {
+		return calcDuration(v, v2, op)
+	}
+	if v, ok := v2.(time.Duration); ok && op == '*' {
+		return calcDuration(v, v1, op)
+	}
+
 	i1, ok := _int64(v1)
 	i2, ok2 := _int64(v2)
 
@@ -655,6 +730,68 @@ func calc(v1, v2 interface{}, op int) interface{} {
 	return nil
 }
 
+// calcTime supports time + duration, time - duration and time - time.
+func calcTime(t time.Time, v interface{}, op int) interface{} {
+	if d, ok := _duration(v); ok {
+		switch op {
+		case '+':
+			return t.Add(d)
+		case '-':
+			return t.Add(-d)
+		}
+		return nil
+	}
+	if t2, ok := _time(v); ok && op == '-' {
+		return t.Sub(t2)
+	}
+	return nil
+}
+
+// calcDuration supports adding and subtracting durations, and multiplying
+// or dividing them by numbers.
+func calcDuration(d time.Duration, v interface{}, op int) interface{} {
+	if _, ok := v.(time.Duration); !ok {
+		if f, ok := _float64(v); ok {
+			switch op {
+			case '*':
+				return time.Duration(float64(d) * f)
+			case '/':
+				if f != 0 {
+					return time.Duration(float64(d) / f)
+				}
+			}
+			return nil
+		}
+		if i, ok := _int64f(v); ok {
+			switch op {
+			case '*':
+				return d * time.Duration(i)
+			case '/':
+				if i != 0 {
+					return d / time.Duration(i)
+				}
+			}
+			return nil
+		}
+	}
+
+	d2, ok := _duration(v)
+	if !ok || (d2 == 0 && (op == '/' || op == '%')) {
+		return nil
+	}
+	switch op {
+	case '+':
+		return d + d2
+	case '-':
+		return d - d2
+	case '/':
+		return int64(d / d2)
+	case '%':
+		return d % d2
+	}
+	return nil
+}
+
 func (g *Graph) index(c *Graph) int {
 	if g.Len() == 0 {
 		return -1
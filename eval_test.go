@@ -501,3 +501,52 @@ func TestEvalCalcStr(t *testing.T) {
 		t.Error("string with numbers")
 	}
 }
+
+func TestEvalResolvers(t *testing.T) {
+
+	p := NewStringParser("t 2024-01-02T03:04:05Z\nd 2h30m\nd2 5s\nh 0xff\ns 1.5KiB\nn null\nq '5s'")
+	p.RegisterScalar(StandardScalars...)
+	g, err := p.ParseTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.Node("n").GetAt(0).This != nil {
+		t.Error("null should be nil")
+	}
+
+	cases := []struct {
+		expr string
+		want string
+		typ  string
+	}{
+		{"d > d2", "true", "bool"},
+		{"d2 < d", "true", "bool"},
+		{"d2 == q", "true", "bool"},
+		{"d2 * 2", "10s", "time.Duration"},
+		{"d + d2", "2h30m5s", "time.Duration"},
+		{"t + d", "2024-01-02T05:34:05Z", "time.Time"},
+		{"h + 1", "256", "int64"},
+		{"s", "1536", "int64"},
+		{"q", "5s", "string"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			r, _ := g.Eval(NewExpression(tc.expr))
+			got := _string(r)
+			gotType := reflect.TypeOf(r).String()
+			if got != tc.want || gotType != tc.typ {
+				t.Errorf("got %s (%s); want %s (%s)", got, gotType, tc.want, tc.typ)
+			}
+		})
+	}
+}
+
+func TestResolversEmpty(t *testing.T) {
+	for i, r := range StandardScalars {
+		if v, ok := r(""); ok {
+			t.Errorf("resolver %d: got %v for empty scalar", i, v)
+		}
+	}
+}
@@ -4,30 +4,107 @@
 
 package ogdl
 
+// EventHandler receives the events produced by the text parser: nodes added
+// at the current level, and changes of level. Parser uses a
+// SimpleEventHandler, which builds a Graph, unless another one is given with
+// NewParserWithHandler.
+//
+// Handlers can optionally implement ReferenceHandler and PositionHandler.
+type EventHandler interface {
+	Add(s string)
+	AddItf(i interface{})
+	Inc()
+	Dec()
+	Level() int
+	SetLevel(l int)
+}
+
+// ReferenceHandler is implemented by event handlers that support OGDL level 2
+// anchors and references. If the handler doesn't implement it, anchors are
+// ignored, and references are added as strings ("+{name}").
+type ReferenceHandler interface {
+	// Anchor labels the last item added.
+	Anchor(name string)
+	// AddReference adds a reference to a labelled item, returning false if
+	// the label is unknown.
+	AddReference(name string) bool
+}
+
+// PositionHandler is implemented by event handlers that record where items
+// come from. If Parser.TrackPositions has been called, SetPosition is called
+// before each item is added.
+type PositionHandler interface {
+	SetPosition(pos Position)
+}
+
 // SimpleEventHandler receives events and produces a tree.
 type SimpleEventHandler struct {
-	current int           // Current level
-	max     int           // Max level
-	levels  []int         // Level of each item
-	items   []interface{} // Items
+	current int            // Current level
+	max     int            // Max level
+	levels  []int          // Level of each item
+	items   []interface{}  // Items
+	track   bool           // Whether to record the source position of items
+	next    Position       // Position of the next item
+	pos     []Position     // Source position of each item, if tracked
+	table   *Positions     // Positions of the nodes created by Tree()
+	anchors map[string]int // Labelled items (name -> index in items)
+}
+
+// reference is an item that stands for a previous item (given by its index).
+type reference int
+
+// record stores the position of the item just added, if tracking.
+func (e *SimpleEventHandler) record() {
+	if e.track {
+		e.pos = append(e.pos, e.next)
+	}
 }
 
 // AddBytes creates a byte array node at the current level
 func (e *SimpleEventHandler) AddBytes(b []byte) {
 	e.items = append(e.items, b)
 	e.levels = append(e.levels, e.current)
+	e.record()
 }
 
 // Add creates a string node at the current level.
 func (e *SimpleEventHandler) Add(s string) {
 	e.items = append(e.items, s)
 	e.levels = append(e.levels, e.current)
+	e.record()
 }
 
 // AddItf creates a string node at the current level.
 func (e *SimpleEventHandler) AddItf(i interface{}) {
 	e.items = append(e.items, i)
 	e.levels = append(e.levels, e.current)
+	e.record()
+}
+
+// Anchor labels the last item added with the given name, so that it can be
+// referenced later with AddReference.
+func (e *SimpleEventHandler) Anchor(name string) {
+	if len(e.items) == 0 {
+		return
+	}
+	if e.anchors == nil {
+		e.anchors = make(map[string]int)
+	}
+	e.anchors[name] = len(e.items) - 1
+}
+
+// AddReference adds, at the current level, a reference to the item last
+// labelled with the given name. In the tree, both will be the same node.
+// It returns false if there is no such label.
+func (e *SimpleEventHandler) AddReference(name string) bool {
+	i, ok := e.anchors[name]
+	if !ok {
+		return false
+	}
+	e.items = append(e.items, reference(i))
+	e.levels = append(e.levels, e.current)
+	e.record()
+	return true
 }
 
 // AddBytesAt creates a byte array node at the specified level
@@ -39,6 +116,15 @@ func (e *SimpleEventHandler) AddBytesAt(b []byte, lv int) {
 	}
 }
 
+// addValueAt creates a node with the given value at the specified level.
+func (e *SimpleEventHandler) addValueAt(v interface{}, lv int) {
+	e.items = append(e.items, v)
+	e.levels = append(e.levels, lv)
+	if e.max < lv {
+		e.max = lv
+	}
+}
+
 // AddAt creates a string node at the specified level.
 func (e *SimpleEventHandler) AddAt(s string, lv int) {
 	e.items = append(e.items, s)
@@ -48,10 +134,18 @@ func (e *SimpleEventHandler) AddAt(s string, lv int) {
 	}
 }
 
+// SetPosition sets the source position of the next item.
+func (e *SimpleEventHandler) SetPosition(pos Position) {
+	e.next = pos
+}
+
 // Delete removes the last node added
 func (e *SimpleEventHandler) Delete() {
 	e.items = e.items[0 : len(e.items)-1]
 	e.levels = e.levels[0 : len(e.levels)-1]
+	if e.track {
+		e.pos = e.pos[0 : len(e.pos)-1]
+	}
 }
 
 // Level returns the current level
@@ -90,14 +184,43 @@ func (e *SimpleEventHandler) Tree() *Graph {
 	g := make([]*Graph, e.max+2)
 	g[0] = New("_")
 
+	if e.track {
+		e.table = &Positions{make(map[*Graph]Position, len(e.items))}
+	}
+
+	// Nodes by item index, needed to resolve references
+	var nodes []*Graph
+	if e.anchors != nil {
+		nodes = make([]*Graph, len(e.items))
+	}
+
 	for i := 0; i < len(e.items); i++ {
 		lv := e.levels[i] + 1
 		item := e.items[i]
 
-		n := New(item)
+		var n *Graph
+		if r, ok := item.(reference); ok && nodes != nil {
+			n = nodes[r]
+		} else {
+			n = New(item)
+			// The position of a shared node is that of its anchor
+			if e.track {
+				e.table.nodes[n] = e.pos[i]
+			}
+		}
 		g[lv] = n
 		g[lv-1].Add(n)
+
+		if nodes != nil {
+			nodes[i] = n
+		}
 	}
 
 	return g[0]
 }
+
+// Positions returns the source position of the nodes created by the last
+// call to Tree(), or nil if positions are not tracked.
+func (e *SimpleEventHandler) Positions() *Positions {
+	return e.table
+}
@@ -94,7 +94,9 @@ func (p *Parser) ArgList() bool {
 		if !p.Expression() {
 
 			p.ev.Dec()
-			p.ev.Delete()
+			if d, ok := p.ev.(interface{ Delete() }); ok {
+				d.Delete()
+			}
 			return something
 		}
 		p.ev.Dec()
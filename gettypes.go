@@ -11,6 +11,7 @@ import (
 	"reflect"
 	"regexp"
 	"strconv"
+	"time"
 )
 
 // Find returns a Graph with all subnodes that match the regular
@@ -104,7 +105,7 @@ func (g *Graph) String(def ...string) string {
 
 // StringCSV returns a comma separated value representation of all direct subnodes.
 // StringCSV accepts one default value, which will be returned instead of an
-// empty string.
+// empty string. Use Graph.CSV to write tables.
 func (g *Graph) StringCSV(def ...string) string {
 
 	// If g is nil, return default or nothing
@@ -584,6 +585,9 @@ func _string(i interface{}) string {
 	if v, ok := i.(*Graph); ok {
 		return v.String()
 	}
+	if v, ok := i.(time.Time); ok {
+		return v.Format(time.RFC3339Nano)
+	}
 	return fmt.Sprint(i)
 }
 
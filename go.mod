@@ -1,5 +1,9 @@
 module github.com/rveen/ogdl
 
-go 1.14
+go 1.16
 
-require golang.org/x/text v0.3.8
+require (
+	github.com/BurntSushi/toml v1.3.2
+	golang.org/x/text v0.3.8
+	gopkg.in/yaml.v3 v3.0.1
+)
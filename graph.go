@@ -37,6 +37,12 @@ func (g *Graph) ThisType() string {
 
 // Equals returns true if the given graph and the receiver graph are equal.
 func (g *Graph) Equals(c *Graph) bool {
+	return g.equals(c, make(map[[2]*Graph]bool))
+}
+
+// equals is the implementation of Equals. Pairs of nodes being compared are
+// recorded, so that comparing graphs with cycles terminates.
+func (g *Graph) equals(c *Graph, seen map[[2]*Graph]bool) bool {
 
 	if c.This != g.This {
 		return false
@@ -45,8 +51,16 @@ func (g *Graph) Equals(c *Graph) bool {
 		return false
 	}
 
+	if g.Len() > 0 {
+		k := [2]*Graph{g, c}
+		if seen[k] {
+			return true
+		}
+		seen[k] = true
+	}
+
 	for i := 0; i < g.Len(); i++ {
-		if !g.Out[i].Equals(c.Out[i]) {
+		if !g.Out[i].equals(c.Out[i], seen) {
 			return false
 		}
 	}
@@ -123,12 +137,25 @@ func (g *Graph) addEqualNodes(g2 *Graph, key string, recurse bool) *Graph {
 // value holds a pointer, copying the interface value makes a copy of the
 // pointer, but not the data it points to.
 func (g *Graph) Copy(c *Graph) {
+	g.copy(c, make(map[*Graph]*Graph))
+}
+
+// copy is the implementation of Copy. Nodes already copied are reused, so
+// that shared nodes and cycles are preserved.
+func (g *Graph) copy(c *Graph, m map[*Graph]*Graph) {
 	if g == nil || c == nil {
 		return
 	}
 	for _, n := range c.Out {
+		if nn, ok := m[n]; ok {
+			g.Add(nn)
+			continue
+		}
 		nn := g.Add(n.This)
-		nn.Copy(n)
+		if nn != nil {
+			m[n] = nn
+		}
+		nn.copy(n, m)
 	}
 }
 
@@ -140,15 +167,25 @@ func (g *Graph) Copy(c *Graph) {
 // value holds a pointer, copying the interface value makes a copy of the
 // pointer, but not the data it points to.
 func (g *Graph) Clone() *Graph {
+	return g.clone(make(map[*Graph]*Graph))
+}
+
+// clone is the implementation of Clone. Nodes already copied are reused, so
+// that shared nodes and cycles are preserved.
+func (g *Graph) clone(m map[*Graph]*Graph) *Graph {
 	if g == nil {
 		return nil
 	}
+	if c, ok := m[g]; ok {
+		return c
+	}
 
 	c := New(nil)
 	c.This = g.This
+	m[g] = c
 
 	for _, n := range g.Out {
-		c.Out = append(c.Out, n.Clone())
+		c.Out = append(c.Out, n.clone(m))
 	}
 	return c
 }
@@ -348,6 +385,9 @@ func (g *Graph) set(path *Graph, val interface{}) *Graph {
 //
 // Strings are quoted if they contain spaces, newlines or special
 // characters. Null elements are not printed, and act as transparent nodes.
+//
+// Nodes that appear more than once are written once, with an anchor, and
+// referenced elsewhere (OGDL level 2).
 func (g *Graph) Text() string {
 	if g == nil {
 		return ""
@@ -355,9 +395,14 @@ func (g *Graph) Text() string {
 
 	buffer := &bytes.Buffer{}
 
+	// The 'root' node is not printed, so it cannot have an anchor. It is
+	// visited here so that it is only written as a reference.
+	r := newRefs(g)
+	r.visit(g)
+
 	// Do not print the 'root' node
 	for _, node := range g.Out {
-		node._text(0, buffer, false)
+		node._text(0, buffer, false, r)
 	}
 
 	// remove trailing \n
@@ -391,7 +436,7 @@ func (g *Graph) Show() string {
 
 	buffer := &bytes.Buffer{}
 
-	g._text(0, buffer, true)
+	g._text(0, buffer, true, newRefs(g))
 
 	// remove trailing \n
 
@@ -416,16 +461,43 @@ func (g *Graph) Show() string {
 	return s
 }
 
+// TextFlow is like Text, but subtrees that fit in a line of the given width
+// are written in one line, using the flow syntax:
+//
+//    a (b c, d e)
+//
+// See Encoder for more options.
+func (g *Graph) TextFlow(width int) string {
+	buffer := &bytes.Buffer{}
+
+	e := NewEncoder(buffer)
+	e.Flow = true
+	e.Width = width
+	e.Encode(g)
+
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
 // _text is the private, lower level, implementation of Text().
 // It takes two parameters, the level and a buffer to which the
-// result is printed.
-func (g *Graph) _text(n int, buffer *bytes.Buffer, show bool) {
+// result is printed. Shared nodes are handled through r, which can be nil.
+func (g *Graph) _text(n int, buffer *bytes.Buffer, show bool, r *refs) {
 
 	sp := ""
 	for i := 0; i < n; i++ {
 		sp += "  "
 	}
 
+	name, done := r.visit(g)
+	if done {
+		buffer.WriteString(sp + "+{" + name + "}\n")
+		return
+	}
+	anchor := ""
+	if name != "" {
+		anchor = "-{" + name + "} "
+	}
+
 	/*
 	   When printing strings with newlines, there are two possibilities:
 	   block or quoted. Block is cleaner, but limited to leaf nodes. If the node
@@ -444,13 +516,16 @@ func (g *Graph) _text(n int, buffer *bytes.Buffer, show bool) {
 		s = _string(g.This)
 	}
 
-	if strings.ContainsAny(s, "\n\r \t'\",()") {
+	if strings.ContainsAny(s, "\n\r \t'\",()") || isReference(s) {
 
 		// print quoted, but not at level 0
 		// Do not convert " to \" below if level==0 !
 		if n > 0 {
 			buffer.WriteString(sp) /* [:len(sp)-1]) */
+			buffer.WriteString(anchor)
 			buffer.WriteByte('"')
+		} else {
+			buffer.WriteString(anchor)
 		}
 
 		var c, cp byte
@@ -479,13 +554,14 @@ func (g *Graph) _text(n int, buffer *bytes.Buffer, show bool) {
 		}
 		buffer.WriteString("\n")
 	} else {
-		if len(s) == 0 && !show {
+		if len(s) == 0 && !show && anchor == "" {
 			n--
 		} else {
-			if len(s) == 0 && show {
+			if len(s) == 0 {
 				s = "_"
 			}
 			buffer.WriteString(sp)
+			buffer.WriteString(anchor)
 			buffer.WriteString(s)
 			buffer.WriteByte('\n')
 		}
@@ -494,7 +570,7 @@ func (g *Graph) _text(n int, buffer *bytes.Buffer, show bool) {
 	if g != nil {
 		for i := 0; i < len(g.Out); i++ {
 			node := g.Out[i]
-			node._text(n+1, buffer, show)
+			node._text(n+1, buffer, show, r)
 		}
 	}
 }
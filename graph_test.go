@@ -1,11 +1,17 @@
 package ogdl
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Test resistance agains nil
@@ -660,6 +666,504 @@ func TestLog(t *testing.T) {
 	os.Remove(file)
 }
 
+func TestLogTypes(t *testing.T) {
+
+	file := "/tmp/logtypes.gb"
+	os.Remove(file)
+
+	log, _ := OpenLog(file)
+	log.SetTypes(true)
+
+	g := New("_")
+	g.Add("n").Add(int64(42))
+	g.Add("f").Add(2.5)
+
+	n := log.Add(g)
+	log.SetTypes(false)
+	m := log.Add(g)
+
+	g2, n2, _ := log.Get(n)
+	b, _, _ := log.GetBinary(n)
+	g3, _, _ := log.Get(m)
+
+	if n2 != m || int64(len(b)) != m || !IsBinaryTypes(b) {
+		t.Error("log positions", n2, m, len(b))
+	}
+	if g2.Node("n").Out[0].This != int64(42) || g2.Node("f").Out[0].This != 2.5 {
+		t.Error("typed log entry", g2.Text())
+	}
+	if g3.Node("n").Out[0].This != "42" {
+		t.Error("untyped log entry", g3.Text())
+	}
+
+	log.Close()
+	os.Remove(file)
+}
+
+func TestLogIter(t *testing.T) {
+
+	file := "/tmp/logiter.gb"
+	os.Remove(file)
+	flog, _ := OpenLog(file)
+	defer os.Remove(file)
+	defer flog.Close()
+
+	for _, log := range []*Log{flog, {}} {
+
+		if g, i, err := log.Last(); g != nil || i != -1 || err != nil || log.Len() != 0 {
+			t.Error("empty log", i, err)
+		}
+		if log.Iter(0).Next() || log.IterReverse(-1).Next() {
+			t.Error("Next on empty log")
+		}
+
+		var offs []int64
+		for i := 0; i < 5; i++ {
+			offs = append(offs, log.Add(FromString("n "+strconv.Itoa(i))))
+		}
+
+		if log.Len() != 5 {
+			t.Error("Len", log.Len())
+		}
+		if g, i, _ := log.Last(); i != offs[4] || g.Get("n").String() != "4" {
+			t.Error("Last", i)
+		}
+
+		// Forward, from the second object
+		n := 1
+		it := log.Iter(offs[1])
+		for it.Next() {
+			if it.Offset() != offs[n] || it.Graph().Get("n").String() != strconv.Itoa(n) {
+				t.Error("Iter", n, it.Offset())
+			}
+			n++
+		}
+		if it.Err() != nil || n != 5 {
+			t.Error("Iter end", n, it.Err())
+		}
+
+		// Newest first, from the fourth object
+		n = 3
+		it = log.IterReverse(offs[3])
+		for it.Next() {
+			if it.Offset() != offs[n] || it.Graph().Get("n").String() != strconv.Itoa(n) {
+				t.Error("IterReverse", n, it.Offset())
+			}
+			n--
+		}
+		if it.Err() != nil || n != -1 {
+			t.Error("IterReverse end", n, it.Err())
+		}
+
+		// Not at the start of an object
+		it = log.Iter(offs[1] + 1)
+		if it.Next() || !errors.Is(it.Err(), ErrBinaryHeader) {
+			t.Error("Iter at bad offset", it.Err())
+		}
+		if log.Iter(-1).Next() {
+			t.Error("Iter at -1")
+		}
+
+		b, next, err := log.GetBinary(offs[2])
+		if err != nil || next != offs[3] || !FromString("n 2").Equals(FromBinary(b)) {
+			t.Error("GetBinary", next, err)
+		}
+		if g, next, err := log.Get(offs[4]); err != nil || g == nil || next <= offs[4] {
+			t.Error("Get", next, err)
+		}
+	}
+}
+
+func TestLogFramed(t *testing.T) {
+
+	file := "/tmp/logframed.gb"
+	os.Remove(file)
+	os.Remove(file + ".torn")
+	defer os.Remove(file)
+	defer os.Remove(file + ".torn")
+
+	log, err := OpenLogOptions(file, &LogOptions{Framed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offs []int64
+	for i := 0; i < 3; i++ {
+		offs = append(offs, log.Add(FromString("n "+strconv.Itoa(i))))
+	}
+	log.Close()
+
+	good, _ := ioutil.ReadFile(file)
+	rec := good[offs[1]:offs[2]]
+
+	tests := []struct {
+		tail []byte // Appended to the good records
+		cut  int64  // Bytes removed on open
+	}{
+		{nil, 0},
+		{rec[:5], 5},                            // Torn header
+		{rec[:len(rec)-1], int64(len(rec) - 1)}, // Torn data
+		{make([]byte, 40), 40},                  // Zeros
+		{append(append([]byte{}, rec[:len(rec)-1]...), 'x'), int64(len(rec))}, // Bad checksum
+	}
+
+	for i, test := range tests {
+		os.Remove(file + ".torn")
+		ioutil.WriteFile(file, append(append([]byte{}, good...), test.tail...), 0666)
+
+		log, err := OpenLogOptions(file, &LogOptions{Quarantine: true})
+		if err != nil {
+			t.Fatal(i, err)
+		}
+
+		r := log.Repaired()
+		if test.cut == 0 && r != nil || test.cut != 0 && (r == nil || r.Offset != int64(len(good)) || r.Bytes != test.cut) {
+			t.Errorf("%d: repair %+v", i, r)
+		}
+		if test.cut != 0 {
+			b, _ := ioutil.ReadFile(file + ".torn")
+			if r.File != file+".torn" || !bytes.Equal(b, test.tail) {
+				t.Errorf("%d: quarantined %q", i, b)
+			}
+		}
+
+		// Sequence numbers continue after the good records
+		n := log.Add(FromString("n 3"))
+		if n != int64(len(good)) || log.Len() != 4 || log.Verify() != nil {
+			t.Errorf("%d: after repair: %d %d %v", i, n, log.Len(), log.Verify())
+		}
+		if g, _, _ := log.Last(); g.Get("n").String() != "3" {
+			t.Errorf("%d: Last", i)
+		}
+		log.Close()
+	}
+
+	// A damaged record in the middle is found by Verify, not by OpenLog
+	b := append([]byte{}, good...)
+	b[offs[1]+logRecordHeader+4] ^= 0xff
+	ioutil.WriteFile(file, b, 0666)
+
+	log, _ = OpenLog(file)
+	var be *BinaryError
+	err = log.Verify()
+	if !errors.Is(err, ErrChecksum) || !errors.As(err, &be) || be.Offset != offs[1] || log.Repaired() != nil {
+		t.Error("Verify", err)
+	}
+	if g, _, err := log.Get(offs[1]); g != nil || !errors.Is(err, ErrChecksum) {
+		t.Error("Get damaged record", err)
+	}
+	log.Close()
+
+	// A damaged header in the middle is not repaired: the log is left as it
+	// is, whether the length now runs past the end or short of it
+	for _, pos := range []int64{2, 5} {
+		b = append([]byte{}, good...)
+		b[offs[1]+pos] ^= 1
+		ioutil.WriteFile(file, b, 0666)
+
+		_, err = OpenLog(file)
+		if !errors.Is(err, ErrLogRecord) || !errors.As(err, &be) {
+			t.Error("damaged header", pos, err)
+		}
+		if c, _ := ioutil.ReadFile(file); !bytes.Equal(c, b) {
+			t.Error("damaged header: the file was changed", pos)
+		}
+	}
+
+	// Records out of sequence
+	b = append(append([]byte{}, good...), good[offs[1]:]...)
+	ioutil.WriteFile(file, b, 0666)
+	log, _ = OpenLog(file)
+	if err = log.Verify(); !errors.Is(err, ErrSequence) {
+		t.Error("Verify sequence", err)
+	}
+	log.Close()
+
+	// A framed log cannot be asked for on an unframed one
+	ioutil.WriteFile(file, FromString("a").Binary(), 0666)
+	if _, err = OpenLogOptions(file, &LogOptions{Framed: true}); err != ErrLogFormat {
+		t.Error("ErrLogFormat", err)
+	}
+}
+
+func TestLogWriteError(t *testing.T) {
+
+	file := "/tmp/logwriteerror.gb"
+	os.Remove(file)
+	defer os.Remove(file)
+
+	log, err := OpenLogOptions(file, &LogOptions{Framed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Add(FromString("n 1"))
+
+	// Writes fail while the file is closed
+	log.f.Close()
+	if i, err := log.AddErr(FromString("n 2")); i != -1 || err == nil {
+		t.Error("AddErr", i, err)
+	}
+	if i := log.Add(FromString("n 2")); i != -1 {
+		t.Error("Add", i)
+	}
+
+	// The failed writes took no sequence number
+	log.f, _ = os.OpenFile(file, os.O_RDWR, 0666)
+	if _, err := log.AddErr(FromString("n 2")); err != nil {
+		t.Error(err)
+	}
+	if log.Len() != 2 || log.Verify() != nil {
+		t.Error("after a failed write", log.Len(), log.Verify())
+	}
+	log.Close()
+}
+
+func TestLogIndex(t *testing.T) {
+
+	file := "/tmp/logindex.gb"
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := &LogOptions{IndexTime: "ts"}
+
+	for _, framed := range []bool{false, true} {
+		os.Remove(file)
+		os.Remove(file + ".idx")
+		opts.Framed = framed
+
+		log, err := OpenLogOptions(file, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var offs []int64
+		for i := 0; i < 10; i++ {
+			g := New("_")
+			g.Add("n").Add(strconv.Itoa(i))
+			g.Add("ts").Add(t0.Add(time.Duration(i) * time.Minute).Format(time.RFC3339))
+			offs = append(offs, log.Add(g))
+		}
+
+		check := func(name string, log *Log) {
+			for _, n := range []uint64{1, 5, 10} {
+				g, off, err := log.GetSeq(n)
+				if err != nil || off != offs[n-1] || g.Get("n").String() != strconv.Itoa(int(n-1)) {
+					t.Error(name, framed, "GetSeq", n, off, err)
+				}
+			}
+			if _, _, err := log.GetSeq(uint64(len(offs) + 1)); err != ErrNotFound {
+				t.Error(name, framed, "GetSeq after the last", err)
+			}
+
+			it := log.SeekTime(t0.Add(150 * time.Second))
+			if !it.Next() || it.Offset() != offs[3] {
+				t.Error(name, framed, "SeekTime", it.Offset(), it.Err())
+			}
+			if it = log.SeekTime(t0.Add(time.Hour)); it.Next() || it.Err() != nil {
+				t.Error(name, framed, "SeekTime after the end", it.Err())
+			}
+			if it = log.SeekTime(t0.Add(-time.Hour)); !it.Next() || it.Offset() != 0 {
+				t.Error(name, framed, "SeekTime before the start", it.Err())
+			}
+		}
+
+		check("new", log)
+		log.Close()
+
+		// Missing
+		os.Remove(file + ".idx")
+		log, _ = OpenLogOptions(file, opts)
+		check("missing", log)
+		log.Close()
+
+		// Behind the log
+		os.Truncate(file+".idx", logIndexHeader+4*logIndexEntry)
+		log, _ = OpenLogOptions(file, opts)
+		check("behind", log)
+		log.Close()
+
+		// Pointing to a wrong object
+		f, _ := os.OpenFile(file+".idx", os.O_WRONLY, 0666)
+		f.WriteAt([]byte{0, 0, 0, 0, 0, 0, 0, 1}, logIndexHeader+9*logIndexEntry)
+		f.Close()
+		log, _ = OpenLogOptions(file, opts)
+		check("wrong", log)
+		log.Close()
+
+		// An index that cannot be written is dropped, and caught up on open
+		log, _ = OpenLogOptions(file, opts)
+		log.idx.f.Close()
+		g := New("_")
+		g.Add("n").Add("10")
+		off, err := log.AddErr(g)
+		if err != nil {
+			t.Error(framed, "AddErr with a failed index", err)
+		}
+		offs = append(offs, off)
+		if g, _, err := log.GetSeq(11); err != nil || g.Get("n").String() != "10" {
+			t.Error(framed, "GetSeq after a failed index", err)
+		}
+		if it := log.SeekTime(t0); it.Next() || it.Err() == nil || it.Err() == ErrNoTimeIndex {
+			t.Error(framed, "SeekTime after a failed index", it.Err())
+		}
+		log.Close()
+		log, _ = OpenLogOptions(file, opts)
+		check("dropped", log)
+		log.Close()
+
+		// Without index
+		log, _ = OpenLog(file)
+		if g, off, err := log.GetSeq(7); err != nil || off != offs[6] || g.Get("n").String() != "6" {
+			t.Error(framed, "GetSeq without index", off, err)
+		}
+		if it := log.SeekTime(t0); it.Next() || it.Err() != ErrNoTimeIndex {
+			t.Error(framed, "SeekTime without index", it.Err())
+		}
+		log.Close()
+	}
+
+	os.Remove(file)
+	os.Remove(file + ".idx")
+}
+
+func TestLogConcurrent(t *testing.T) {
+
+	file := "/tmp/logconcurrent.gb"
+
+	for _, kind := range []string{"file", "framed", "memory"} {
+		os.Remove(file)
+		framed := kind == "framed"
+
+		log := &Log{}
+		switch kind {
+		case "file":
+			log, _ = OpenLog(file)
+		case "framed":
+			log, _ = OpenLogOptions(file, &LogOptions{Framed: true, Index: true})
+		}
+
+		const writers, objects = 8, 50
+		var wg sync.WaitGroup
+		errs := make(chan string, writers*objects)
+
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < objects; i++ {
+					s := strconv.Itoa(w) + "." + strconv.Itoa(i)
+					off := log.Add(FromString("n " + s))
+
+					// Read back while others write
+					if g, _, err := log.Get(off); err != nil || g.Get("n").String() != s {
+						errs <- "Get " + s
+					}
+					it := log.Iter(0)
+					for it.Next() {
+					}
+					if it.Err() != nil {
+						errs <- "Iter " + it.Err().Error()
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+		for e := range errs {
+			t.Error(kind, e)
+		}
+
+		if n := log.Len(); n != writers*objects {
+			t.Error(kind, "Len", n)
+		}
+		if err := log.Verify(); err != nil {
+			t.Error(kind, "Verify", err)
+		}
+		if framed {
+			if g, _, err := log.GetSeq(writers * objects); err != nil || g == nil {
+				t.Error("GetSeq", err)
+			}
+		}
+		log.Close()
+	}
+	os.Remove(file)
+	os.Remove(file + ".idx")
+}
+
+func TestLogIndexDrop(t *testing.T) {
+
+	file := "/tmp/logindexdrop.gb"
+	os.Remove(file)
+	os.Remove(file + ".idx")
+
+	opts := &LogOptions{Framed: true, IndexTime: "ts"}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := func(i int) *Graph {
+		return FromString("ts " + t0.Add(time.Duration(i)*time.Minute).Format(time.RFC3339))
+	}
+
+	log, err := OpenLogOptions(file, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		log.Add(ts(i))
+	}
+	log.Close()
+
+	for round := 0; round < 10; round++ {
+		log, _ = OpenLogOptions(file, opts)
+
+		// An index that can be read but not written
+		log.mu.Lock()
+		ro, _ := os.Open(file + ".idx")
+		log.idx.f.Close()
+		log.idx.f = ro
+		log.mu.Unlock()
+
+		// Readers while the index is dropped
+		var wg sync.WaitGroup
+		var started sync.WaitGroup
+		done := make(chan bool)
+		errs := make(chan error, 4)
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			started.Add(1)
+			go func() {
+				defer wg.Done()
+				started.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					if _, _, err := log.GetSeq(uint64(i%10 + 1)); err != nil {
+						errs <- err
+						return
+					}
+					// The write error once dropped, but not a closed file
+					it := log.SeekTime(t0)
+					if it.Next(); errors.Is(it.Err(), os.ErrClosed) {
+						errs <- it.Err()
+						return
+					}
+				}
+			}()
+		}
+		started.Wait()
+		if _, err := log.AddErr(ts(100 + round)); err != nil {
+			t.Error(err)
+		}
+		close(done)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(round, err)
+		}
+		log.Close()
+	}
+
+	os.Remove(file)
+	os.Remove(file + ".idx")
+}
+
 // -------------------------------------------------------------------------
 // EXAMPLES
 // -------------------------------------------------------------------------
@@ -717,3 +1221,17 @@ func ExampleGraph_Check() {
 	// Output:
 	// true
 }
+
+func ExampleGraph_TextFlow() {
+
+	g := FromString("a (b c, d e), f")
+	g.Add("long").Add("one two three four five six").Add("x")
+
+	fmt.Println(g.TextFlow(20))
+	// Output:
+	// a (b c, d e)
+	// f
+	// long
+	//   "one two three four five six"
+	//     x
+}
@@ -0,0 +1,142 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// MaxIncludeDepth is the maximum nesting of !include directives.
+var MaxIncludeDepth = 16
+
+// Includes enables the processing of !include directives by Parse. A line
+// such as
+//
+//	!include common/net.ogdl
+//
+// at any indentation level is replaced by the content of the named file,
+// read from fsys. Paths are relative to the directory of the including file
+// (see SetFile), and use forward slashes, as required by fs.FS. Use
+// os.DirFS to read from disk, or an embed.FS.
+//
+// Include cycles and a nesting deeper than MaxIncludeDepth are errors.
+// Positions are tracked, so that Positions() tells the file each node comes
+// from.
+func (p *Parser) Includes(fsys fs.FS) {
+	p.fsys = fsys
+	p.TrackPositions()
+}
+
+// ParseFS parses the named OGDL file from fsys, processing !include
+// directives. See Parser.Includes.
+func ParseFS(fsys fs.FS, name string) (*Graph, error) {
+	p, err := openFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return p.Parse()
+}
+
+// openFS returns a parser for the named file, with includes enabled.
+func openFS(fsys fs.FS, name string) (*Parser, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	p := NewBytesParser(b)
+	p.SetFile(name)
+	p.Includes(fsys)
+	return p, nil
+}
+
+// include replaces the !include directives found in g by the content of
+// the files they name.
+func (p *Parser) include(g *Graph) error {
+	seen := make(map[*Graph]bool)
+
+	var walk func(g *Graph) error
+	walk = func(g *Graph) error {
+		if seen[g] {
+			return nil
+		}
+		seen[g] = true
+
+		var out []*Graph
+		for _, n := range g.Out {
+			if n.ThisString() != "!include" {
+				if err := walk(n); err != nil {
+					return err
+				}
+				out = append(out, n)
+				continue
+			}
+
+			h, err := p.includeFile(n)
+			if err != nil {
+				return err
+			}
+			out = append(out, h.Out...)
+		}
+		g.Out = out
+		return nil
+	}
+
+	return walk(g)
+}
+
+// includeFile parses the file named in an !include directive.
+func (p *Parser) includeFile(n *Graph) (*Graph, error) {
+
+	pos := p.Positions().Pos(n)
+	fail := func(err error) (*Graph, error) {
+		return nil, &ParseError{Position: pos, Err: err}
+	}
+
+	if n.Len() != 1 || n.Out[0].Len() != 0 {
+		return fail(ErrInvalidInclude)
+	}
+
+	name := strings.TrimPrefix(n.Out[0].ThisString(), "/")
+	if !path.IsAbs(n.Out[0].ThisString()) {
+		name = path.Join(path.Dir(p.file), name)
+	}
+
+	if len(p.stack) >= MaxIncludeDepth {
+		return fail(ErrIncludeDepth)
+	}
+	for _, s := range p.stack {
+		if s == name {
+			return fail(ErrIncludeCycle)
+		}
+	}
+	if name == p.file {
+		return fail(ErrIncludeCycle)
+	}
+
+	q, err := openFS(p.fsys, name)
+	if err != nil {
+		return fail(err)
+	}
+	q.stack = append(append([]string(nil), p.stack...), p.file)
+	q.resolvers = p.resolvers
+
+	g, err := q.result(q.parse(p.types))
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge the positions of the included nodes, if this parser keeps them
+	// (it doesn't with a custom event handler)
+	ps, qs := p.Positions(), q.Positions()
+	if ps == nil || qs == nil {
+		return g, nil
+	}
+	for k, v := range qs.nodes {
+		ps.nodes[k] = v
+	}
+	return g, nil
+}
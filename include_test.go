@@ -0,0 +1,97 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestInclude(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"conf/main.ogdl":       {Data: []byte("service a\n  !include common/net.ogdl\n  port 80\n!include /top.ogdl")},
+		"conf/common/net.ogdl": {Data: []byte("ip 10.0.0.1\n!include dns.ogdl")},
+		"conf/common/dns.ogdl": {Data: []byte("dns 8.8.8.8")},
+		"top.ogdl":             {Data: []byte("version 2")},
+		"loop.ogdl":            {Data: []byte("a\n  !include loop2.ogdl")},
+		"loop2.ogdl":           {Data: []byte("b\n  !include loop.ogdl")},
+		"bad.ogdl":             {Data: []byte("a\n  !include")},
+		"missing.ogdl":         {Data: []byte("!include nothing.ogdl")},
+	}
+
+	g, err := ParseFS(fsys, "conf/main.ogdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "service\n  a\n  ip\n    10.0.0.1\n  dns\n    8.8.8.8\n  port\n    80\nversion\n  2"
+	if g.Text() != want {
+		t.Errorf("got\n%s\nwant\n%s", g.Text(), want)
+	}
+
+	p, _ := openFS(fsys, "conf/main.ogdl")
+	g, _ = p.Parse()
+	if pos := p.Positions().Pos(g.Node("service").Node("dns")); pos.String() != "conf/common/dns.ogdl:1:1" {
+		t.Error("position of included node", pos)
+	}
+
+	var tests = []struct {
+		file string
+		err  error
+	}{
+		{"loop.ogdl", ErrIncludeCycle},
+		{"bad.ogdl", ErrInvalidInclude},
+	}
+
+	for _, test := range tests {
+		_, err := ParseFS(fsys, test.file)
+		if !errors.Is(err, test.err) {
+			t.Error(test.file, err)
+		}
+	}
+
+	MaxIncludeDepth = 1
+	_, err = ParseFS(fsys, "conf/main.ogdl")
+	MaxIncludeDepth = 16
+	if !errors.Is(err, ErrIncludeDepth) {
+		t.Error("depth", err)
+	}
+
+	_, err = ParseFS(fsys, "missing.ogdl")
+	if err == nil || err.Error() != "missing.ogdl:1:1: open nothing.ogdl: file does not exist" {
+		t.Error(err)
+	}
+
+	// Includes are not processed unless enabled
+	g, err = ParseString("!include a.ogdl")
+	if err != nil || g.Get("'!include'.'a.ogdl'") == nil {
+		t.Error("!include should be a normal node by default", g.Text())
+	}
+}
+
+// treeHandler is a custom event handler that builds a tree.
+type treeHandler struct {
+	*SimpleEventHandler
+}
+
+func TestIncludeHandler(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"net.ogdl": {Data: []byte("ip 10.0.0.1")},
+	}
+
+	p := NewParserWithHandler(strings.NewReader("a\n  !include net.ogdl"), treeHandler{&SimpleEventHandler{}})
+	p.Includes(fsys)
+
+	g, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := g.Text(); s != "a\n  ip\n    10.0.0.1" {
+		t.Error(s)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gini converts between INI or Java properties files and graphs.
+//
+// Sections and keys are nodes, and dots in their names separate the
+// elements of a path, so that
+//
+//	[server.http]
+//	port = 8080
+//
+// and
+//
+//	server.http.port = 8080
+//
+// both give a graph where g.Get("server.http.port") is 8080. Values are
+// strings, as in OGDL text. A key that is given more than once keeps the
+// last value.
+package gini
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/rveen/ogdl"
+)
+
+var (
+	// ErrSyntax is returned for lines that cannot be read.
+	ErrSyntax = errors.New("syntax error")
+	// ErrNotSupported is returned when writing lists, or values with line
+	// breaks to INI.
+	ErrNotSupported = errors.New("value not supported by the format")
+)
+
+// FromINI converts an INI file into a graph. Lines starting with ; or # are
+// comments. Keys and values are separated by = or :, and values may be
+// enclosed in double or single quotes. A key without separator has no
+// value (null in JSON).
+func FromINI(b []byte) (*ogdl.Graph, error) {
+
+	g := ogdl.New("_")
+	sec := g
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	line := 0
+	off := 0
+	for sc.Scan() {
+		text := sc.Text()
+		line++
+		pos := off
+		off += len(text) + 1
+		// The scanner drops the \r of \r\n line ends
+		if pos+len(text) < len(b) && b[pos+len(text)] == '\r' {
+			off++
+		}
+
+		s := strings.TrimSpace(text)
+		if s == "" || s[0] == ';' || s[0] == '#' {
+			continue
+		}
+
+		if s[0] == '[' {
+			if s[len(s)-1] != ']' || len(s) < 3 {
+				return nil, &ogdl.ParseError{Position: ogdl.Position{Offset: int64(pos), Line: line, Column: 1}, Snippet: text, Err: ErrSyntax}
+			}
+			sec = node(g, strings.TrimSpace(s[1:len(s)-1]))
+			continue
+		}
+
+		i := strings.IndexAny(s, "=:")
+		if i < 0 {
+			set(node(sec, s), nil)
+			continue
+		}
+		if i == 0 {
+			return nil, &ogdl.ParseError{Position: ogdl.Position{Offset: int64(pos), Line: line, Column: 1}, Snippet: text, Err: ErrSyntax}
+		}
+		set(node(sec, strings.TrimSpace(s[:i])), unquote(strings.TrimSpace(s[i+1:])))
+	}
+	return g, sc.Err()
+}
+
+// INI converts a graph to INI, following the rules of Graph.JSON. Keys with
+// a single value are written first, and then each table as a section, with
+// the path of the table as name.
+func INI(g *ogdl.Graph) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := section(buf, "", g); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// section writes the keys of the table held by g, and then its subtables.
+func section(buf *bytes.Buffer, path string, g *ogdl.Graph) error {
+
+	var sub []*ogdl.Graph
+	var pairs []*ogdl.Graph
+	for _, k := range keys(g) {
+		c := k.Content()
+		switch {
+		case c != nil && c.IsList():
+			return ErrNotSupported
+		case c == nil || c.Len() == 0 && !c.IsMap():
+			pairs = append(pairs, k)
+		default:
+			sub = append(sub, k)
+		}
+	}
+
+	if path != "" && (len(pairs) > 0 || len(sub) == 0) {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("[" + path + "]\n")
+	}
+
+	for _, k := range pairs {
+		buf.WriteString(k.ThisString())
+		if c := k.Content(); c != nil && c.This != nil {
+			s := c.ThisString()
+			if strings.ContainsAny(s, "\r\n") {
+				return ErrNotSupported
+			}
+			buf.WriteString(" = " + quote(s))
+		}
+		buf.WriteByte('\n')
+	}
+
+	for _, k := range sub {
+		p := k.ThisString()
+		if path != "" {
+			p = path + "." + p
+		}
+		if err := section(buf, p, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unquote removes the quotes around a value.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// quote adds double quotes to a value that would otherwise change when read
+// back.
+func quote(s string) string {
+	if s != strings.TrimSpace(s) || unquote(s) != s {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// node returns the node at the given dotted path below g, creating it if
+// needed.
+func node(g *ogdl.Graph, path string) *ogdl.Graph {
+	for _, s := range strings.Split(path, ".") {
+		g = g.NodeOrNew(s)
+	}
+	return g
+}
+
+// set replaces the value of a key, keeping its subkeys. A nil value is
+// stored as a nil node.
+func set(k *ogdl.Graph, v interface{}) {
+	out := k.Out[:0]
+	for _, n := range k.Out {
+		if n.Len() != 0 {
+			out = append(out, n)
+		}
+	}
+	k.Out = append(out, ogdl.New(v))
+}
+
+// keys returns the keys of the table held by g.
+func keys(g *ogdl.Graph) []*ogdl.Graph {
+	c := g.Content()
+	switch {
+	case c == nil:
+		return nil
+	case c == g || c.IsMap():
+		return c.Out
+	}
+	return []*ogdl.Graph{c}
+}
@@ -0,0 +1,124 @@
+package gini
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rveen/ogdl"
+)
+
+func TestFromINI(t *testing.T) {
+
+	in := `; comment
+name = top
+[server]
+host = example.com
+port: 8080
+flag
+[server.http]
+path = " /a "
+# comment
+[db]
+user = 'x'
+user = y
+`
+	g, err := FromINI([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := string(g.JSON())
+	if s != `{"name":"top","server":{"host":"example.com","port":"8080","flag":null,"http":{"path":" /a "}},"db":{"user":"y"}}` {
+		t.Error(s)
+	}
+	if s := g.Get("server.port").String(); s != "8080" {
+		t.Error(s)
+	}
+
+	b, err := INI(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := `name = top
+
+[server]
+host = example.com
+port = 8080
+flag
+
+[server.http]
+path = " /a "
+
+[db]
+user = y
+`
+	if string(b) != out {
+		t.Errorf("got\n%s", b)
+	}
+}
+
+func TestINIErrors(t *testing.T) {
+
+	_, err := FromINI([]byte("a = 1\n[b\n"))
+	var pe *ogdl.ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 || !errors.Is(err, ErrSyntax) {
+		t.Error(err)
+	}
+
+	_, err = FromINI([]byte("a = 1\r\nb = 2\r\n[c\r\n"))
+	if !errors.As(err, &pe) || pe.Line != 3 || pe.Offset != 14 {
+		t.Error(err, pe.Offset)
+	}
+
+	g, _ := ogdl.FromJSON([]byte(`{"a":[1]}`))
+	if _, err := INI(g); err != ErrNotSupported {
+		t.Error(err)
+	}
+}
+
+func TestProperties(t *testing.T) {
+
+	in := `# comment
+! comment
+server.host = example.com
+server.port:8080
+server.name   my\
+    server
+key\ with\ spaces = a\tbé
+empty
+`
+	g, err := FromProperties([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := string(g.JSON())
+	if s != `{"server":{"host":"example.com","port":"8080","name":"myserver"},"key with spaces":"a\tbé","empty":""}` {
+		t.Error(s)
+	}
+
+	b, err := Properties(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := `server.host=example.com
+server.port=8080
+server.name=myserver
+key\ with\ spaces=a\tbé
+empty=
+`
+	if string(b) != out {
+		t.Errorf("got\n%s", b)
+	}
+
+	if _, err := FromProperties([]byte("a = \\u00g1")); !errors.Is(err, ErrSyntax) {
+		t.Error(err)
+	}
+
+	// The position of an entry after a continued line
+	_, err = FromProperties([]byte("a = 1\nb = 2 \\\n  3\nc = \\u00g1"))
+	var pe *ogdl.ParseError
+	if !errors.As(err, &pe) || pe.Line != 4 || pe.Offset != 18 || pe.Snippet != "c = \\u00g1" {
+		t.Error(err, pe)
+	}
+}
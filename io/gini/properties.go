@@ -0,0 +1,201 @@
+// Copyright 2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gini
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rveen/ogdl"
+)
+
+// FromProperties converts a Java properties file into a graph, following the
+// format of java.util.Properties: lines starting with # or ! are comments,
+// keys are separated from values by =, : or spaces, a \ at the end of a
+// line continues it in the next one, and \t, \n, \r, \f and \uXXXX are
+// escapes.
+func FromProperties(b []byte) (*ogdl.Graph, error) {
+
+	g := ogdl.New("_")
+
+	lines := strings.Split(string(b), "\n")
+
+	// off is the offset of line i, and start that of the first line of an
+	// entry
+	off := 0
+	for i := 0; i < len(lines); off, i = off+len(lines[i])+1, i+1 {
+		line, start := i+1, off
+		s := strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+		if s == "" || s[0] == '#' || s[0] == '!' {
+			continue
+		}
+
+		// Join continuation lines
+		for continued(s) && i+1 < len(lines) {
+			off += len(lines[i]) + 1
+			i++
+			s = s[:len(s)-1] + strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+		}
+		if continued(s) {
+			s = s[:len(s)-1]
+		}
+
+		// The key ends at the first unescaped separator
+		k := 0
+		for k < len(s) && !strings.ContainsRune("=: \t\f", rune(s[k])) {
+			if s[k] == '\\' {
+				k++
+			}
+			k++
+		}
+		if k > len(s) {
+			k = len(s)
+		}
+
+		v := strings.TrimLeft(s[k:], " \t\f")
+		if v != "" && (v[0] == '=' || v[0] == ':') {
+			v = strings.TrimLeft(v[1:], " \t\f")
+		}
+
+		key, err := unescape(s[:k])
+		if err == nil {
+			v, err = unescape(v)
+		}
+		if err != nil {
+			return nil, &ogdl.ParseError{Position: ogdl.Position{Offset: int64(start), Line: line, Column: 1}, Snippet: lines[line-1], Err: err}
+		}
+		set(node(g, key), v)
+	}
+	return g, nil
+}
+
+// Properties converts a graph to a Java properties file, following the rules
+// of Graph.JSON. Each key with a value is written with its full path, as in
+// server.http.port=8080. Null values are written as empty strings.
+func Properties(g *ogdl.Graph) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := properties(buf, "", g); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// properties writes the keys of the table held by g, with the given prefix.
+func properties(buf *bytes.Buffer, prefix string, g *ogdl.Graph) error {
+
+	for _, k := range keys(g) {
+		c := k.Content()
+		p := prefix + k.ThisString()
+
+		switch {
+		case c != nil && c.IsList():
+			return ErrNotSupported
+		case c == nil || c.Len() == 0 && !c.IsMap():
+			buf.WriteString(escape(p, true) + "=")
+			if c != nil && c.This != nil {
+				buf.WriteString(escape(c.ThisString(), false))
+			}
+			buf.WriteByte('\n')
+		default:
+			if err := properties(buf, p+".", k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// continued returns true if a line ends with an odd number of backslashes.
+func continued(s string) bool {
+	n := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// unescape replaces the escape sequences of a key or value.
+func unescape(s string) (string, error) {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", ErrSyntax
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", ErrSyntax
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// escape returns a key or value as written in a properties file. In keys,
+// separators are escaped, and in values, leading spaces.
+func escape(s string, key bool) string {
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			if key {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		case ' ':
+			if key || i == 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(' ')
+		default:
+			if r < 0x20 || r == utf8.RuneError && size == 1 {
+				b.WriteString(`\u00`)
+				b.WriteString(strconv.FormatUint(uint64(s[i])>>4, 16))
+				b.WriteString(strconv.FormatUint(uint64(s[i])&0xf, 16))
+			} else {
+				b.WriteString(s[i : i+size])
+			}
+		}
+		i += size
+	}
+	return b.String()
+}
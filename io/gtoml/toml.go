@@ -0,0 +1,364 @@
+// Copyright 2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gtoml converts between TOML and graphs, using the conventions of
+// ogdl.FromJSON and Graph.JSON:
+//
+// - Tables are a subnode per key, in the order of the text, each holding the
+// value of the key. Dotted keys and table headers, as [server.http], are
+// nested nodes.
+// - Arrays are a '_' node with a subnode per element, and tables that are
+// elements of an array, including arrays of tables, are '{}' nodes.
+// - Values are leaf nodes of type string, int64, float64, bool or time.Time.
+//
+// so that
+//
+//	[server]
+//	host = "example.com"
+//	ports = [80, 443]
+//
+// gives a graph where g.Get("server.host") is example.com.
+package gtoml
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rveen/ogdl"
+)
+
+// ErrNull is returned by TOML for nodes without value, that TOML cannot
+// represent.
+var ErrNull = errors.New("TOML has no null value")
+
+// FromTOML converts a TOML document into a graph.
+func FromTOML(b []byte) (*ogdl.Graph, error) {
+
+	var m map[string]interface{}
+	md, err := toml.Decode(string(b), &m)
+	if err != nil {
+		return nil, err
+	}
+
+	// The decoded tables are maps: sort their keys as in the text.
+	order := make(map[string]int)
+	for _, k := range md.Keys() {
+		for i := range k {
+			p := strings.Join(k[:i+1], "\x00")
+			if _, ok := order[p]; !ok {
+				order[p] = len(order)
+			}
+		}
+	}
+
+	d := decoder{order}
+	g := ogdl.New("_")
+	d.table(g, m, "")
+	return g, nil
+}
+
+// decoder holds the position of each key in the text. Keys are joined with
+// a zero byte, that cannot be part of a key.
+type decoder struct {
+	order map[string]int
+}
+
+// table adds the keys of a table to g.
+func (d decoder) table(g *ogdl.Graph, m map[string]interface{}, path string) {
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return d.order[path+keys[i]] < d.order[path+keys[j]]
+	})
+
+	for _, k := range keys {
+		d.value(g.Add(k), m[k], path+k+"\x00", false)
+	}
+}
+
+// value adds a TOML value to g. If elem is true the value is an element of
+// an array, and a table has its own '{}' node.
+func (d decoder) value(g *ogdl.Graph, v interface{}, path string, elem bool) {
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if elem || len(v) == 0 {
+			g = g.Add("{}")
+		} else if len(v) == 1 {
+			// A single key '_' or '{}' would be taken for an array or table
+			for k := range v {
+				if k == "_" || k == "{}" {
+					g = g.Add("{}")
+				}
+			}
+		}
+		d.table(g, v, path)
+
+	case []map[string]interface{}:
+		l := g.Add("_")
+		for _, e := range v {
+			d.value(l, e, path, true)
+		}
+
+	case []interface{}:
+		l := g.Add("_")
+		for _, e := range v {
+			d.value(l, e, path, true)
+		}
+
+	default:
+		g.Add(v)
+	}
+}
+
+// TOML converts a graph to TOML, following the rules of Graph.JSON. The
+// value held by g must be a table. Arrays whose elements are all tables are
+// written as arrays of tables, and the other ones inline.
+func TOML(g *ogdl.Graph) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := table(buf, nil, tableKeys(g), false); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// table writes a table with the given keys, and then its subtables. The
+// header is written if the table has key/value pairs, is empty, or is an
+// element of an array of tables.
+func table(buf *bytes.Buffer, path []string, keys []*ogdl.Graph, elem bool) error {
+
+	var sub []*ogdl.Graph
+	var pairs []*ogdl.Graph
+	for _, k := range keys {
+		if isTable(k.Content()) || isArrayOfTables(k.Content()) {
+			sub = append(sub, k)
+		} else {
+			pairs = append(pairs, k)
+		}
+	}
+
+	if len(path) > 0 && (elem || len(pairs) > 0 || len(keys) == 0) {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		if elem {
+			buf.WriteString("[[" + dotted(path) + "]]\n")
+		} else {
+			buf.WriteString("[" + dotted(path) + "]\n")
+		}
+	}
+
+	for _, k := range pairs {
+		buf.WriteString(key(k.ThisString()) + " = ")
+		if err := inline(buf, k.Content()); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+	}
+
+	for _, k := range sub {
+		p := append(path[:len(path):len(path)], k.ThisString())
+		c := k.Content()
+		if isTable(c) {
+			if err := table(buf, p, tableKeys(k), false); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, e := range c.Out {
+			if err := table(buf, p, e.Out, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// inline writes a value in one line: a leaf, or a '_' or '{}' node.
+func inline(buf *bytes.Buffer, n *ogdl.Graph) error {
+
+	switch {
+	case n == nil:
+		return ErrNull
+	case n.IsList():
+		buf.WriteByte('[')
+		for i, e := range n.Out {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := inline(buf, element(e)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case n.Len() == 0 && !n.IsMap():
+		return leaf(buf, n.This)
+	default:
+		buf.WriteByte('{')
+		for i, k := range n.Out {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(key(k.ThisString()) + " = ")
+			if err := inline(buf, k.Content()); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	}
+	return nil
+}
+
+// element returns the node that stands for an element of an array.
+func element(g *ogdl.Graph) *ogdl.Graph {
+	if g.Len() == 0 || g.IsList() || g.IsMap() {
+		return g
+	}
+	// A map with a single key
+	m := ogdl.New("{}")
+	m.Add(g)
+	return m
+}
+
+// tableKeys returns the keys of the table held by g.
+func tableKeys(g *ogdl.Graph) []*ogdl.Graph {
+	c := g.Content()
+	if c == nil {
+		return nil
+	}
+	if c != g && !c.IsMap() {
+		return []*ogdl.Graph{c}
+	}
+	return c.Out
+}
+
+// isTable returns true if the value is a table that is not empty, and so
+// written with a header.
+func isTable(n *ogdl.Graph) bool {
+	return n != nil && n.Len() > 0 && !n.IsList() && (n.IsMap() || n.Len() > 1 || n.Out[0].Len() > 0)
+}
+
+// isArrayOfTables returns true if the value is an array whose elements are
+// all tables.
+func isArrayOfTables(n *ogdl.Graph) bool {
+	if n == nil || !n.IsList() || n.Len() == 0 {
+		return false
+	}
+	for _, e := range n.Out {
+		if !e.IsMap() {
+			return false
+		}
+	}
+	return true
+}
+
+// leaf writes a scalar value.
+func leaf(buf *bytes.Buffer, v interface{}) error {
+
+	switch v := v.(type) {
+	case nil:
+		return ErrNull
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(float(v))
+	case time.Time:
+		buf.WriteString(datetime(v))
+	default:
+		buf.WriteString(quote(ogdl.New(v).ThisString()))
+	}
+	return nil
+}
+
+// float formats a float64 as TOML.
+func float(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// datetime formats a time, that may be one of the local date and time
+// types of TOML.
+func datetime(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "date-local":
+		return t.Format("2006-01-02")
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// dotted returns the keys of a table header.
+func dotted(path []string) string {
+	ks := make([]string, len(path))
+	for i, s := range path {
+		ks[i] = key(s)
+	}
+	return strings.Join(ks, ".")
+}
+
+// key returns a key, quoted if it is not a bare key.
+func key(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return quote(s)
+		}
+	}
+	return s
+}
+
+// quote returns a TOML basic string.
+func quote(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	b := []byte{'"'}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			if c < 0x20 || c == 0x7f {
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return string(append(b, '"'))
+}
@@ -0,0 +1,86 @@
+package gtoml
+
+import (
+	"testing"
+
+	"github.com/rveen/ogdl"
+)
+
+const config = `title = "TOML \"example\""
+version = 2
+ratio = 0.5
+enabled = true
+date = 1979-05-27T07:32:00Z
+day = 1979-05-27
+tags = ["a", "b"]
+matrix = [[1, 2], [3]]
+mixed = [{x = 1, y = 2}, 3]
+empty = {}
+
+[server]
+host = "example.com"
+ports = [80, 443]
+
+[server.http]
+timeout = 30.0
+
+[[fruit]]
+name = "apple"
+
+[fruit.color]
+red = 1
+
+[[fruit]]
+name = "banana"
+`
+
+func TestRoundTrip(t *testing.T) {
+
+	g, err := FromTOML([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := TOML(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != config {
+		t.Errorf("got\n%s", b)
+	}
+}
+
+func TestFromTOML(t *testing.T) {
+
+	g, err := FromTOML([]byte("z = 1\na.b.c = \"x\"\n[t]\nk = 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(g.JSON()); s != `{"z":1,"a":{"b":{"c":"x"}},"t":{"k":2}}` {
+		t.Error(s)
+	}
+	if s := g.Get("a.b.c").String(); s != "x" {
+		t.Error(s)
+	}
+
+	// The same as FromJSON
+	j, _ := ogdl.FromJSON([]byte(`{"l":[[1],{"a":true}],"_":{"_":"x"}}`))
+	b, err := TOML(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err = FromTOML(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(g.JSON()) != string(j.JSON()) {
+		t.Error(string(g.JSON()), string(b))
+	}
+}
+
+func TestNull(t *testing.T) {
+	j, _ := ogdl.FromJSON([]byte(`{"a":null}`))
+	if _, err := TOML(j); err != ErrNull {
+		t.Error(err)
+	}
+}
@@ -1,8 +1,31 @@
+// Copyright 2018-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gxml converts between XML and graphs. An element is a node named
+// as the element, whose subnodes are its attributes, as '@name' nodes
+// holding the value, followed by its content: text as leaf nodes, and child
+// elements. For example,
+//
+//	<host id="web">10.0.0.1<port>80</port></host>
+//
+// is
+//
+//	host
+//	  @id
+//	    web
+//	  10.0.0.1
+//	  port
+//	    80
+//
+// Comments, processing instructions and directives are not kept. The
+// mapping is further controlled by Options.
 package gxml
 
 import (
 	"bytes"
 	"encoding/xml"
+	"io"
 	"strings"
 	"unicode"
 
@@ -12,6 +35,22 @@ import (
 	"golang.org/x/text/unicode/norm"
 )
 
+// Options control the mapping of XML to a graph. The zero Options are those
+// of FromXML: element names without namespace prefix, accents or '-'
+// (replaced by '_'), attributes named by their local name (xmlns:s is
+// '@s'), trimmed text kept in place between child elements, and nothing
+// for empty elements.
+type Options struct {
+	Namespaces bool // Keep namespace prefixes, as in 'soap:Body' and '@xmlns:s'
+	Verbatim   bool // Keep element names as they are
+	Space      bool // Keep the space around text, and text that is only space
+	Join       bool // Join the text of an element as its first subnode, after the attributes
+	Empty      bool // Give empty elements an empty string, so that they are not taken for text
+}
+
+// Lossless are the options for which ToXML(Parse(b)) is equivalent to b.
+var Lossless = Options{Namespaces: true, Verbatim: true, Space: true, Empty: true}
+
 func Simplify(g *ogdl.Graph) {
 	if g.Out == nil {
 		return
@@ -36,63 +75,189 @@ func Simplify(g *ogdl.Graph) {
 	}
 }
 
+// FromXML converts an XML document into a graph, with the zero Options,
+// ignoring errors. Use Parse for other options.
 func FromXML(b []byte) *ogdl.Graph {
+	g, _ := parse(b, &Options{})
+	return g
+}
 
-	decoder := xml.NewDecoder(bytes.NewReader(b))
+// Parse converts an XML document into a graph, with the given options. A nil
+// opts means Lossless.
+func Parse(b []byte, opts *Options) (*ogdl.Graph, error) {
+	if opts == nil {
+		opts = &Lossless
+	}
+	g, err := parse(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
 
-	g := ogdl.New(nil)
-	var key string
-	level := -1
+// element is an element being read.
+type element struct {
+	n     *ogdl.Graph
+	attrs int          // Number of attributes
+	text  bytes.Buffer // Text, if Join
+	empty bool         // No content yet
+}
+
+// parse returns the graph read until an error is found, and the error.
+func parse(b []byte, opts *Options) (*ogdl.Graph, error) {
 
-	att := true
+	dec := xml.NewDecoder(bytes.NewReader(b))
 
-	var stack []*ogdl.Graph
-	stack = append(stack, g)
+	g := ogdl.New(nil)
+	stack := []*element{{n: g}}
 
 	tr := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	name := func(n xml.Name) string {
+		s := n.Local
+		if opts.Namespaces && n.Space != "" {
+			s = n.Space + ":" + s
+		}
+		if !opts.Verbatim {
+			// No accents in names, and - -> _
+			s, _, _ = transform.String(tr, s)
+			s = strings.Replace(s, "-", "_", -1)
+		}
+		return s
+	}
 
 	for {
-		// Read tokens from the XML document in a stream.
-		t, _ := decoder.Token()
+		// Prefixes are only kept by RawToken, that does not resolve them
+		var t xml.Token
+		var err error
+		if opts.Namespaces {
+			t, err = dec.RawToken()
+		} else {
+			t, err = dec.Token()
+		}
 		if t == nil {
-			break
+			if err == io.EOF {
+				err = nil
+				if len(stack) > 1 {
+					err = io.ErrUnexpectedEOF
+				}
+			}
+			return g, err
 		}
-		// Inspect the type of the token just read.
+
+		e := stack[len(stack)-1]
+
 		switch se := t.(type) {
 
 		case xml.StartElement:
-			level++
-
-			key = se.Name.Local
-			// No accents in key
-			key, _, _ = transform.String(tr, key)
-			// - -> _
-			key = strings.Replace(key, "-", "_", -1)
-
-			n := stack[len(stack)-1].Add(key)
-			// push
-			stack = append(stack, n)
-			if att {
-				for _, at := range se.Attr {
-					n.Add("@" + at.Name.Local).Add(at.Value)
+			e.empty = false
+			c := &element{n: e.n.Add(name(se.Name)), empty: true}
+			for _, at := range se.Attr {
+				s := at.Name.Local
+				if opts.Namespaces && at.Name.Space != "" {
+					s = at.Name.Space + ":" + s
 				}
+				c.n.Add("@" + s).Add(at.Value)
+				c.attrs++
 			}
+			stack = append(stack, c)
 
 		case xml.CharData:
-
-			val := strings.TrimSpace(string(se))
-			if len(val) > 0 {
-				stack[len(stack)-1].Add(val)
+			s := string(se)
+			if !opts.Space {
+				s = strings.TrimSpace(s)
+			}
+			if s == "" || len(stack) == 1 && strings.TrimSpace(s) == "" {
+				continue
+			}
+			e.empty = false
+			if opts.Join {
+				e.text.WriteString(s)
+			} else {
+				e.n.Add(s)
 			}
 
 		case xml.EndElement:
-			level--
-			// pop
-
+			// RawToken does not check that elements match
+			if len(stack) == 1 || name(se.Name) != e.n.ThisString() {
+				return g, &xml.SyntaxError{Msg: "unexpected end element </" + se.Name.Local + ">"}
+			}
 			stack = stack[:len(stack)-1]
 
+			switch {
+			case e.text.Len() > 0:
+				// The text goes after the attributes
+				out := append([]*ogdl.Graph{}, e.n.Out[:e.attrs]...)
+				out = append(out, ogdl.New(e.text.String()))
+				e.n.Out = append(out, e.n.Out[e.attrs:]...)
+			case e.empty && opts.Empty:
+				e.n.Add("")
+			}
 		}
 	}
+}
 
-	return g
+// ToXML converts a graph to XML, writing each subnode of g as an element
+// (or text, if it is a leaf). Subnodes of an element whose name starts with
+// '@' are written as attributes.
+func ToXML(g *ogdl.Graph) []byte {
+	buf := &bytes.Buffer{}
+	if g != nil {
+		for _, n := range g.Out {
+			write(buf, n)
+		}
+	}
+	return buf.Bytes()
+}
+
+// write writes a node as an element, or as text if it is a leaf.
+func write(buf *bytes.Buffer, g *ogdl.Graph) {
+
+	if g.Len() == 0 {
+		escape(buf, g.ThisString(), false)
+		return
+	}
+
+	name := g.ThisString()
+	buf.WriteString("<" + name)
+	for _, n := range g.Out {
+		if s := n.ThisString(); strings.HasPrefix(s, "@") && n.Len() > 0 {
+			buf.WriteString(" " + s[1:] + `="`)
+			escape(buf, n.Out[0].ThisString(), true)
+			buf.WriteByte('"')
+		}
+	}
+	buf.WriteByte('>')
+
+	for _, n := range g.Out {
+		if !strings.HasPrefix(n.ThisString(), "@") || n.Len() == 0 {
+			write(buf, n)
+		}
+	}
+	buf.WriteString("</" + name + ">")
+}
+
+// escape writes text with the characters that are special in XML replaced by
+// references. In attribute values, quotes and white space other than ' '
+// are also replaced.
+func escape(buf *bytes.Buffer, s string, attr bool) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '&':
+			buf.WriteString("&amp;")
+		case c == '<':
+			buf.WriteString("&lt;")
+		case c == '>':
+			buf.WriteString("&gt;")
+		case c == '\r':
+			buf.WriteString("&#xD;")
+		case attr && c == '"':
+			buf.WriteString("&quot;")
+		case attr && c == '\n':
+			buf.WriteString("&#xA;")
+		case attr && c == '\t':
+			buf.WriteString("&#x9;")
+		default:
+			buf.WriteByte(c)
+		}
+	}
 }
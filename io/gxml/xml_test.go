@@ -0,0 +1,79 @@
+package gxml
+
+import (
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+
+	var tests = []string{
+		`<a><b x="1" y="&lt;&quot;&gt;">text</b><c></c></a>`,
+		`<p>Some <b>bold</b> and <i>italic</i> text &amp; more.</p>`,
+		`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body><m:Get xmlns:m="urn:x">1</m:Get></soap:Body></soap:Envelope>`,
+		"<list>\n  <item>1</item>\n  <item>2</item>\n</list>",
+		`<a>@b</a><c></c>`,
+	}
+
+	for _, s := range tests {
+		g, err := Parse([]byte(s), nil)
+		if err != nil {
+			t.Error(s, err)
+			continue
+		}
+		if b := string(ToXML(g)); b != s {
+			t.Errorf("got %s, expected %s", b, s)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+
+	in := `<?xml version="1.0"?>
+<r xmlns="urn:r" xmlns:n="urn:n">
+  <n:señal-a id="1"/>
+  <p>one <b>two</b> three</p>
+</r>`
+
+	var tests = []struct {
+		opts Options
+		text string
+	}{
+		{Options{}, "r\n  @xmlns\n    urn:r\n  @n\n    urn:n\n  senal_a\n    @id\n      1\n  p\n    one\n    b\n      two\n    three"},
+		{Options{Verbatim: true, Join: true}, "r\n  @xmlns\n    urn:r\n  @n\n    urn:n\n  señal-a\n    @id\n      1\n  p\n    onethree\n    b\n      two"},
+		{Options{Namespaces: true, Verbatim: true}, "r\n  @xmlns\n    urn:r\n  @xmlns:n\n    urn:n\n  n:señal-a\n    @id\n      1\n  p\n    one\n    b\n      two\n    three"},
+	}
+
+	for _, tt := range tests {
+		g, err := Parse([]byte(in), &tt.opts)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if s := g.Text(); s != tt.text {
+			t.Errorf("%+v: got\n%s", tt.opts, s)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, s := range []string{`<a><b></a>`, `<a>`, `</a>`} {
+		if _, err := Parse([]byte(s), nil); err == nil {
+			t.Error("expected error", s)
+		}
+		if _, err := Parse([]byte(s), &Options{}); err == nil {
+			t.Error("expected error", s)
+		}
+	}
+	if g := FromXML([]byte(`<a><b>1</b>`)); g.Get("a.b").String() != "1" {
+		t.Error(g.Text())
+	}
+}
+
+func TestFromXML(t *testing.T) {
+
+	// The mapping of FromXML doesn't depend on the options of Parse
+	g := FromXML([]byte(`<a xmlns:s="u"><b/><c>1</c></a>`))
+	if g.This != nil || g.Text() != "a\n  @s\n    u\n  b\n  c\n    1" {
+		t.Error(g.Show())
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gyaml converts between YAML and graphs, using the conventions of
+// ogdl.FromJSON and Graph.JSON:
+//
+// - The root node ('_') holds the value of the document.
+// - Mappings are a subnode per key, in the order of the text, each holding
+// the value of the key.
+// - Sequences are a '_' node with a subnode per element.
+// - Mappings that are elements of a sequence are a '{}' node holding the
+// keys. An empty mapping is a '{}' leaf.
+// - Scalars are leaf nodes, with the Go type of their YAML tag: string,
+// int64, float64, bool, time.Time, []byte, or nil for null.
+//
+// A stream with several documents has a '---' node per document, holding its
+// value. Aliases are replaced by a copy of the anchored value.
+//
+// Multi-line strings are kept without their trailing line breaks, so that
+// they are written as OGDL block scalars by an ogdl.Encoder with Blocks set.
+package gyaml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rveen/ogdl"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrAliases is returned by FromYAML if aliases expand to more than
+// MaxAliasNodes nodes, as in a 'billion laughs' document.
+var ErrAliases = errors.New("YAML aliases expand to too many nodes")
+
+// MaxAliasNodes is the maximum number of nodes that FromYAML creates while
+// expanding aliases.
+var MaxAliasNodes = 1 << 20
+
+// FromYAML converts a YAML stream into a graph.
+//
+//	name: web
+//	ports: [80, 443]
+//
+// is converted to
+//
+//	name
+//	  web
+//	ports
+//	  _
+//	    80
+//	    443
+func FromYAML(b []byte) (*ogdl.Graph, error) {
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+
+	d := &decoder{}
+
+	var docs []*ogdl.Graph
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		g := ogdl.New("---")
+		if len(doc.Content) > 0 {
+			if err := d.value(g, doc.Content[0], false, false); err != nil {
+				return nil, err
+			}
+		}
+		docs = append(docs, g)
+	}
+
+	g := ogdl.New("_")
+	switch len(docs) {
+	case 0:
+	case 1:
+		g.Out = docs[0].Out
+	default:
+		g.Out = docs
+	}
+	return g, nil
+}
+
+// decoder counts the nodes created by aliases.
+type decoder struct {
+	aliased int
+}
+
+// value adds a YAML node to g. If elem is true the node is an element of a
+// sequence, and a mapping has its own '{}' node. If alias is true, the node
+// is being copied from an anchor.
+func (d *decoder) value(g *ogdl.Graph, n *yaml.Node, elem, alias bool) error {
+
+	if alias {
+		d.aliased++
+		if d.aliased > MaxAliasNodes {
+			return ErrAliases
+		}
+	}
+
+	switch n.Kind {
+	case yaml.AliasNode:
+		return d.value(g, n.Alias, elem, true)
+
+	case yaml.SequenceNode:
+		l := g.Add("_")
+		for _, e := range n.Content {
+			if err := d.value(l, e, true, alias); err != nil {
+				return err
+			}
+		}
+
+	case yaml.MappingNode:
+		o := ogdl.New("{}")
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := o.Add(scalar(n.Content[i]))
+			if err := d.value(k, n.Content[i+1], false, alias); err != nil {
+				return err
+			}
+		}
+
+		// As in ogdl.FromJSON, the keys are added to g unless the mapping is
+		// an element, is empty, or its only key is '_' or '{}'.
+		if elem || o.Len() == 0 || o.Len() == 1 && (o.Out[0].IsList() || o.Out[0].IsMap()) {
+			g.Add(o)
+		} else {
+			g.AddNodes(o)
+		}
+
+	default:
+		// Add(nil) does nothing
+		g.Add(ogdl.New(scalar(n)))
+	}
+	return nil
+}
+
+// scalar returns the value of a scalar node, according to its tag.
+func scalar(n *yaml.Node) interface{} {
+
+	if n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	if n.Kind != yaml.ScalarNode {
+		return n.Value
+	}
+
+	switch n.ShortTag() {
+	case "!!str":
+		if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+			return strings.TrimRight(n.Value, "\n")
+		}
+		return n.Value
+	case "!!null":
+		return nil
+	}
+
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return n.Value
+	}
+
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return float64(v)
+		}
+		return int64(v)
+	}
+	return v
+}
+
+// YAML converts a graph to YAML, following the rules of Graph.JSON. If all
+// the subnodes of g are '---' nodes, each is written as a document.
+//
+// Shared nodes are written at each occurrence, and cycles are an error.
+func YAML(g *ogdl.Graph) ([]byte, error) {
+
+	docs := []*ogdl.Graph{g}
+	if g.Len() > 0 {
+		multi := true
+		for _, n := range g.Out {
+			if n.ThisString() != "---" {
+				multi = false
+				break
+			}
+		}
+		if multi {
+			docs = g.Out
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+
+	for _, d := range docs {
+		e := encoder{make(map[*ogdl.Graph]bool)}
+		n, err := e.value(d)
+		if err != nil {
+			return nil, err
+		}
+		if err = enc.Encode(n); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encoder holds the nodes being written, to detect cycles.
+type encoder struct {
+	path map[*ogdl.Graph]bool
+}
+
+// value returns the YAML node for the value held by g.
+func (e encoder) value(g *ogdl.Graph) (*yaml.Node, error) {
+
+	if e.path[g] {
+		return nil, ogdl.ErrCycle
+	}
+	e.path[g] = true
+	defer delete(e.path, g)
+
+	return e.content(g)
+}
+
+// content returns the YAML node for the value held by g, that is already
+// in the path.
+func (e encoder) content(g *ogdl.Graph) (*yaml.Node, error) {
+	switch c := g.Content(); {
+	case c == nil:
+		return leaf(nil), nil
+	case c != g:
+		return e.element(c)
+	}
+	return e.mapping(g.Out)
+}
+
+// element returns the YAML node for g as an element of a sequence.
+func (e encoder) element(g *ogdl.Graph) (*yaml.Node, error) {
+
+	if e.path[g] {
+		return nil, ogdl.ErrCycle
+	}
+	e.path[g] = true
+	defer delete(e.path, g)
+
+	switch {
+	case g.IsList():
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, c := range g.Out {
+			m, err := e.element(c)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, m)
+		}
+		return n, nil
+	case g.IsMap():
+		return e.mapping(g.Out)
+	case g.Len() == 0:
+		return leaf(g.This), nil
+	}
+
+	v, err := e.content(g)
+	if err != nil {
+		return nil, err
+	}
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{leaf(g.ThisString()), v}}, nil
+}
+
+// mapping returns a YAML mapping with the given nodes as keys.
+func (e encoder) mapping(keys []*ogdl.Graph) (*yaml.Node, error) {
+
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, k := range keys {
+		v, err := e.value(k)
+		if err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, leaf(k.ThisString()), v)
+	}
+	return n, nil
+}
+
+// leaf returns the YAML scalar for a value.
+func leaf(v interface{}) *yaml.Node {
+
+	n := &yaml.Node{Kind: yaml.ScalarNode}
+
+	switch v := v.(type) {
+	case nil:
+		n.Tag, n.Value = "!!null", "null"
+	case string:
+		n.Tag, n.Value = "!!str", v
+		if strings.Contains(v, "\n") {
+			n.Style = yaml.LiteralStyle
+		}
+	case bool:
+		n.Tag, n.Value = "!!bool", strconv.FormatBool(v)
+	case int64:
+		n.Tag, n.Value = "!!int", strconv.FormatInt(v, 10)
+	case float64:
+		n.Tag, n.Value = "!!float", float(v)
+	case time.Time:
+		n.Tag, n.Value = "!!timestamp", v.Format(time.RFC3339Nano)
+	default:
+		if err := n.Encode(v); err != nil {
+			n.Tag, n.Value = "!!str", ogdl.New(v).ThisString()
+		}
+	}
+	return n
+}
+
+// float formats a float64 as YAML.
+func float(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return ".nan"
+	case math.IsInf(f, 1):
+		return ".inf"
+	case math.IsInf(f, -1):
+		return "-.inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+package gyaml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rveen/ogdl"
+)
+
+const manifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  labels:
+    app: web
+spec:
+  containers:
+    - name: nginx
+      image: nginx:1.25
+      ports:
+        - containerPort: 80
+      args: []
+      resources: {}
+  restartPolicy: null
+  hostNetwork: false
+  ratio: 0.5
+`
+
+func TestRoundTrip(t *testing.T) {
+
+	for _, s := range []string{manifest, "- a\n- - b\n  - c\n", "a: 1\n---\nb: 2\n", "_:\n  x: 1\n"} {
+		g, err := FromYAML([]byte(s))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		b, err := YAML(g)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(b) != s && string(b) != "---\n"+s {
+			t.Errorf("got\n%s\nexpected\n%s", b, s)
+		}
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+
+	g, err := FromYAML([]byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := g.Node("spec").Node("containers").Node("_").Out[0]
+	if s := string(c.Node("ports").JSON()); s != `[{"containerPort":80}]` {
+		t.Error("ports", s)
+	}
+	if v := g.Node("spec").Node("ratio").Out[0].This; v != 0.5 {
+		t.Errorf("ratio %v", v)
+	}
+	if v := g.Node("spec").Node("restartPolicy").Out[0].This; v != nil {
+		t.Errorf("null %v", v)
+	}
+
+	// The same as FromJSON
+	j, _ := ogdl.FromJSON([]byte(`[{"a":[1,true]},{}]`))
+	y, _ := FromYAML([]byte("- a: [1, true]\n- {}\n"))
+	if string(j.JSON()) != string(y.JSON()) {
+		t.Error(string(y.JSON()))
+	}
+}
+
+func TestBlock(t *testing.T) {
+
+	g, err := FromYAML([]byte("script: |\n  echo a\n  echo b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	e := ogdl.NewEncoder(&b)
+	e.Blocks = true
+	e.Encode(g)
+
+	if b.String() != "script \\\n  echo a\n  echo b\n" {
+		t.Error(b.String())
+	}
+
+	y, _ := YAML(g)
+	if string(y) != "script: |-\n  echo a\n  echo b\n" {
+		t.Error(string(y))
+	}
+}
+
+func TestAliases(t *testing.T) {
+
+	g, err := FromYAML([]byte("a: &x [1, 2]\nb: *x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(g.JSON()); s != `{"a":[1,2],"b":[1,2]}` {
+		t.Error(s)
+	}
+
+	lol := "a: &a [x, x, x, x, x, x, x, x, x, x]\n"
+	for c := byte('b'); c <= 'j'; c++ {
+		p := string(c - 1)
+		lol += string(c) + ": &" + string(c) + " [*" + p + ", *" + p + ", *" + p + ", *" + p + ", *" + p + ", *" + p + ", *" + p + ", *" + p + ", *" + p + ", *" + p + "]\n"
+	}
+	if _, err := FromYAML([]byte(lol)); err != ErrAliases {
+		t.Error("expected", ErrAliases, err)
+	}
+}
+
+func TestCycle(t *testing.T) {
+	g := ogdl.New("_")
+	a := g.Add("a")
+	a.Add(a)
+	if _, err := YAML(g); err != ogdl.ErrCycle {
+		t.Error(err)
+	}
+}
@@ -43,6 +43,8 @@ type Lexer struct {
 	lastByte     int       // If not -1, then the buffer contains the last byte of the stream at this position.
 	lastRuneSize []int     // used by UnreadRune.
 	err          error
+	base         mark // Position of buf[0] in the stream
+	last         mark // Last position computed, see mark()
 }
 
 const maxConsecutiveEmptyReads = 100
@@ -73,6 +75,7 @@ func (p *Lexer) fill() {
 	// The first time read the full buffer, else only half.
 	offset := 0
 	if p.r >= 0 {
+		p.discard(halfSize)
 		copy(p.buf, p.buf[halfSize:])
 		p.r = halfSize
 		offset = halfSize
@@ -142,6 +145,11 @@ func (p *Lexer) Byte() (byte, error) {
 	return c, nil
 }
 
+// eos returns true if all bytes in the stream have been read.
+func (p *Lexer) eos() bool {
+	return p.lastByte < bufSize && p.r >= p.lastByte
+}
+
 // UnreadByte unreads the last byte. It can unread all buffered bytes.
 func (p *Lexer) UnreadByte() {
 	if p.r <= 0 {
@@ -196,6 +204,33 @@ func (p *Lexer) String() (string, bool) {
 	return string(buf), len(buf) > 0
 }
 
+// word is a String that stops at the separators of the flow syntax: a
+// comma followed by space, a break or the end, and inside a group (depth > 0)
+// a closing parenthesis. Parenthesis and commas in other places are part of
+// the word, as in f(x) or 1,5.
+func (p *Lexer) word(depth int) (string, bool) {
+
+	var buf []byte
+
+	for {
+		c, _ := p.Byte()
+		if !IsTextChar(c) || (c == ')' && depth > 0) {
+			break
+		}
+		if c == ',' {
+			c2, _ := p.Byte()
+			p.UnreadByte()
+			if !IsTextChar(c2) || (c2 == ')' && depth > 0) {
+				break
+			}
+		}
+		buf = append(buf, c)
+	}
+
+	p.UnreadByte()
+	return string(buf), len(buf) > 0
+}
+
 // StringStop is a concatenation of text bytes that are not in the parameter stopBytes
 func (p *Lexer) StringStop(stopBytes []byte) (string, bool) {
 
@@ -546,6 +581,10 @@ func (p *Lexer) Block(nsp int) (string, bool) {
 		ns, u := p.Space()
 
 		if u == 0 || ns <= nsp {
+			// The indentation belongs to the next line
+			for i := ns; i > 0; i-- {
+				p.UnreadByte()
+			}
 			break
 		}
 
@@ -589,42 +628,118 @@ func (p *Lexer) Block(nsp int) (string, bool) {
 	return s, true
 }
 
+// Reference ::= ('-' | '+') '{' name '}'
+//
+// An anchor, -{name}, labels the node that follows it in the same line. A
+// reference, +{name}, stands for a node previously labelled with that name
+// (OGDL level 2). It returns '-' or '+', the name, and true if found.
+func (p *Lexer) Reference() (byte, string, bool) {
+
+	c, _ := p.Byte()
+	if c != '-' && c != '+' {
+		p.UnreadByte()
+		return 0, "", false
+	}
+
+	n := 1
+	if c2, _ := p.Byte(); c2 == '{' {
+		n++
+		name, _ := p.StringStop([]byte("{}"))
+		n += len(name)
+		if c2, _ = p.Byte(); c2 == '}' && len(name) > 0 {
+			// The reference must be followed by space, a break or the end
+			c3, _ := p.Byte()
+			p.UnreadByte()
+			if !IsTextChar(c3) {
+				return c, name, true
+			}
+		}
+	}
+
+	for ; n >= 0; n-- {
+		p.UnreadByte()
+	}
+	return 0, "", false
+}
+
+// isReference returns true if the string would be parsed as an anchor or a
+// reference. Such strings must be quoted when written as OGDL text.
+func isReference(s string) bool {
+	return len(s) > 3 && (s[0] == '-' || s[0] == '+') && s[1] == '{' && s[len(s)-1] == '}'
+}
+
 // Scalar ::= quoted | string
 func (p *Lexer) Scalar(n int) (string, bool) {
-	b, ok, _ := p.Quoted(n)
-	if ok {
-		return b, true
+	s, ok, _ := p.scalar(n, -1)
+	return s, ok
+}
+
+// scalar is Scalar, but also returns the error of an invalid quoted string.
+// Unquoted strings are read with word(depth), or with String() if depth < 0.
+func (p *Lexer) scalar(n, depth int) (string, bool, error) {
+	b, ok, err := p.Quoted(n)
+	if ok || err != nil {
+		return b, ok, err
 	}
-	return p.String()
+	if depth < 0 {
+		b, ok = p.String()
+	} else {
+		b, ok = p.word(depth)
+	}
+	return b, ok, nil
 }
 
 // ScalarType ::= string | int64 | float64 | bool
 func (p *Lexer) ScalarType(n int) (interface{}, bool) {
-	b, ok, _ := p.Quoted(n)
-	if ok {
-		return b, true
+	v, ok, _ := p.scalarType(n, -1, nil)
+	return v, ok
+}
+
+// scalarType is ScalarType, but also returns the error of an invalid quoted
+// string. See scalar for the meaning of depth. Unquoted strings are given
+// first to the resolvers, in order (see Parser.RegisterScalar).
+func (p *Lexer) scalarType(n, depth int, rs []ScalarResolver) (interface{}, bool, error) {
+	b, ok, err := p.Quoted(n)
+	if ok || err != nil {
+		return b, ok, err
 	}
 
-	s, ok := p.String()
+	var s string
+	if depth < 0 {
+		s, ok = p.String()
+	} else {
+		s, ok = p.word(depth)
+	}
 	if !ok {
-		return "", false
+		return "", false, nil
+	}
+	return typed(s, rs), true, nil
+}
+
+// typed converts an unquoted string with the given resolvers, or else to
+// int64, float64 or bool, if possible.
+func typed(s string, rs []ScalarResolver) interface{} {
+	for _, r := range rs {
+		if v, ok := r(s); ok {
+			return v
+		}
 	}
 
 	i, err := strconv.ParseInt(s, 10, 64)
 	if err == nil {
-		return i, true
+		return i
 	}
 	f, err := strconv.ParseFloat(s, 64)
 	if err == nil {
-		return f, true
+		return f
 	}
 	switch s {
 	case "true":
-		return true, true
+		return true
 	case "false":
-		return false, true
+		return false
 	default:
-		return s, true
+		return s
 	}
 }
 
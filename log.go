@@ -6,79 +6,257 @@ package ogdl
 
 import (
 	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
 	"os"
+	"sync"
+	"sync/atomic"
 )
 
 // Log is a log store for binary OGDL objects.
 //
-// All objects are appended to a file, and a position is returned.
+// All objects are appended to a file, and a position is returned. The zero
+// Log keeps the objects in memory (see Bytes).
+//
+// A framed log (see LogOptions) stores each object in a record with its
+// length, a sequence number and a CRC32 checksum, so that a record left
+// incomplete by an interrupted write can be detected and removed:
+//
+//     record ::= 0x02 'R' length seq crc data
+//     length ::= uint32, big endian, the length of data
+//     seq    ::= uint64, big endian, 1 for the first record, then consecutive
+//     crc    ::= uint32, big endian, CRC32 (IEEE) of seq and data
+//     data   ::= binary OGDL
+//
+// A Log can be used from several goroutines at once. Objects are appended
+// one after the other, and readers only see objects that are completely
+// written. With autoSync (see SetSync), the fsync of the file is shared by the
+// objects added at the same time.
 //
 type Log struct {
+	// end is the size of the log, up to the last object completely written.
+	// It is read with atomic operations, and changed with mu held.
+	end int64
+
+	// mu serializes appends. smu serializes syncs, and protects synced, the
+	// size of the log when the last sync started.
+	mu     sync.Mutex
+	smu    sync.Mutex
+	synced int64
+
 	f        *os.File
 	autoSync bool
+	types    bool
 	b        bytes.Buffer
+
+	file   string
+	framed bool
+	seq    uint64 // Sequence number of the last object
+	repair *LogRepair
+
+	idx      *logIndex
+	idxErr   error // Why the index was dropped
+	timePath *Graph
 }
 
-// OpenLog opens a log file. If the file doesn't exist, it is created.
+// LogOptions are the options of OpenLogOptions. A nil *LogOptions selects the
+// defaults.
+type LogOptions struct {
+	Framed     bool   // Store objects in records with length, sequence number and CRC32
+	Quarantine bool   // Keep the bytes removed by a repair, in the file name + ".torn"
+	Index      bool   // Keep an index of sequence numbers, for GetSeq, in the file name + ".idx"
+	IndexTime  string // Path of the time of each object, as 'ts', to be indexed for SeekTime (implies Index)
+}
+
+// LogRepair describes the repair of a framed log done when opening it: the
+// bytes from Offset to the end of the file, that didn't hold complete and
+// correct records, were removed.
+type LogRepair struct {
+	Offset int64  // Where the log was truncated
+	Bytes  int64  // Bytes removed
+	File   string // The file that holds the removed bytes, if quarantined
+}
+
+// logRecordHeader is the length of the header of a record in a framed log.
+const logRecordHeader = 18
+
+// OpenLog opens a log file. If the file doesn't exist, it is created. Framed
+// logs are checked and repaired, as with OpenLogOptions.
 func OpenLog(file string) (*Log, error) {
+	return OpenLogOptions(file, nil)
+}
+
+// OpenLogOptions opens a log file. If the file doesn't exist, it is created.
+//
+// Whether a log is framed is decided when it is created, and found out from
+// the file later; it is an error to ask for a framed log on a file with
+// unframed objects. When a framed log is opened, its records are walked and
+// the last one is checked: a torn record at the end, and whatever follows
+// it, is removed (see Repaired). A bad record followed by good ones is not a
+// torn write, and is returned as a *BinaryError, leaving the file as it is.
+// Use Verify to check every record.
+func OpenLogOptions(file string, opts *LogOptions) (*Log, error) {
+
+	if opts == nil {
+		opts = &LogOptions{}
+	}
 
 	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, err
 	}
 
-	log := Log{f: f, autoSync: true}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	log := Log{f: f, autoSync: true, file: file, framed: opts.Framed, end: fi.Size(), synced: fi.Size()}
+
+	c := make([]byte, 1)
+	if n, _ := f.ReadAt(c, 0); n == 1 {
+		log.framed = c[0] == 2
+		if opts.Framed && !log.framed {
+			f.Close()
+			return nil, ErrLogFormat
+		}
+	}
+
+	if log.framed {
+		if err = log.recover(opts.Quarantine); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	if opts.Index || opts.IndexTime != "" {
+		if err = log.openIndex(opts.IndexTime); err != nil {
+			log.Close()
+			return nil, err
+		}
+	}
 
 	return &log, nil
 }
 
+// openLogRead opens a log file only for reading, as it is: it is neither
+// repaired nor indexed.
+func openLogRead(file string) (*Log, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	log := &Log{f: f, file: file, end: fi.Size(), synced: fi.Size()}
+
+	c := make([]byte, 1)
+	if n, _ := f.ReadAt(c, 0); n == 1 {
+		log.framed = c[0] == 2
+	}
+	return log, nil
+}
+
+// Repaired returns what was removed from a framed log when opening it, or
+// nil if it was intact.
+func (log *Log) Repaired() *LogRepair {
+	return log.repair
+}
+
 // Close closes a log file
 func (log *Log) Close() {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
 	if log.f != nil {
 		log.f.Close()
 	}
+	if log.idx != nil {
+		log.idx.f.Close()
+	}
 }
 
 // Sync commits the changes to disk (the exact behavior is OS dependent).
 func (log *Log) Sync() {
 	if log.f != nil {
-		log.f.Sync()
+		log.sync(atomic.LoadInt64(&log.end))
+	}
+}
+
+// sync commits the log to disk up to position end. Concurrent callers share
+// one fsync: the ones that arrive while a sync is running wait for it, and
+// the next sync covers everything they wrote.
+func (log *Log) sync(end int64) error {
+
+	log.smu.Lock()
+	defer log.smu.Unlock()
+
+	if log.synced >= end {
+		return nil
+	}
+	n := atomic.LoadInt64(&log.end)
+	if err := log.f.Sync(); err != nil {
+		return err
 	}
+	log.synced = n
+	return nil
 }
 
 // Sync commits the changes to disk (the exact behavior is OS dependent).
 func (log *Log) SetSync(sync bool) {
+	log.mu.Lock()
 	log.autoSync = sync
+	log.mu.Unlock()
+}
+
+// SetTypes selects the typed binary format (see Graph.BinaryTypes) for the
+// objects added with Add, so that Get returns them with their Go types.
+// Objects of both formats can be read from the same log.
+func (log *Log) SetTypes(types bool) {
+	log.mu.Lock()
+	log.types = types
+	log.mu.Unlock()
 }
 
 // Add adds an OGDL object to the log. The starting position into the log
-// is returned.
+// is returned, or -1 if the object could not be written (see AddErr).
 func (log *Log) Add(g *Graph) int64 {
-
-	b := g.Binary()
-
-	if b == nil {
-		return 0
+	i, err := log.AddErr(g)
+	if err != nil {
+		return -1
 	}
+	return i
+}
 
-	if log.f != nil {
-
-		i, _ := log.f.Seek(0, 2)
-
-		log.f.Write(b)
+// AddErr adds an OGDL object to the log, and returns its starting position,
+// or -1 and the error if it could not be written. If it was written but,
+// with autoSync, not synced, both its position and the error are returned.
+func (log *Log) AddErr(g *Graph) (int64, error) {
 
-		if log.autoSync {
-			log.f.Sync()
-		}
+	log.mu.Lock()
+	types := log.types
+	log.mu.Unlock()
 
-		return i
+	var b []byte
+	if types {
+		b = g.BinaryTypes()
 	} else {
+		b = g.Binary()
+	}
 
-		i := log.b.Len()
-		log.b.Write(b)
-
-		return int64(i)
+	if b == nil {
+		return 0, nil
 	}
+
+	return log.add(b, g)
 }
 
 // Bytes works only if we have been writing to the byte buffer, not to a file
@@ -86,83 +264,554 @@ func (log *Log) Bytes() []byte {
 	if log.f != nil {
 		return nil
 	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
 	return log.b.Bytes()
 }
 
 // AddBinary adds an OGDL binary object to the log. The starting position into
-// the log is returned.
+// the log is returned, or -1 if the object could not be written.
 func (log *Log) AddBinary(b []byte) int64 {
+	i, err := log.add(b, nil)
+	if err != nil {
+		return -1
+	}
+	return i
+}
 
-	if log.f != nil {
-		i, _ := log.f.Seek(0, 2)
-		log.f.Write(b)
+// AddBinaryErr is AddBinary, returning errors as AddErr does.
+func (log *Log) AddBinaryErr(b []byte) (int64, error) {
+	return log.add(b, nil)
+}
 
-		if log.autoSync {
-			log.f.Sync()
-		}
+// add appends the binary object b, that is g if not nil. With autoSync, it
+// returns once the object is on disk.
+func (log *Log) add(b []byte, g *Graph) (int64, error) {
 
-		return i
-	} else {
+	log.mu.Lock()
+
+	// The sequence number is taken only if the object is written
+	seq := log.seq + 1
+	if log.framed {
+		b = frame(b, seq)
+	}
+
+	i := log.end
 
-		i := log.b.Len()
+	if log.f == nil {
 		log.b.Write(b)
+		log.seq = seq
+		atomic.StoreInt64(&log.end, i+int64(len(b)))
+		log.mu.Unlock()
+		return i, nil
+	}
+
+	// A failed write is removed, or else overwritten by the next one
+	if _, err := log.f.WriteAt(b, i); err != nil {
+		log.f.Truncate(i)
+		log.mu.Unlock()
+		return -1, err
+	}
+	log.seq = seq
+	atomic.StoreInt64(&log.end, i+int64(len(b)))
 
-		return int64(i)
+	if log.idx != nil {
+		if err := log.index(seq, i, g); err != nil {
+			log.dropIndex(err)
+		}
 	}
+
+	autoSync := log.autoSync
+	log.mu.Unlock()
+
+	if autoSync {
+		if err := log.sync(i + int64(len(b))); err != nil {
+			return i, err
+		}
+	}
+	return i, nil
+}
+
+// frame returns b in a record with the given sequence number.
+func frame(b []byte, seq uint64) []byte {
+
+	r := make([]byte, logRecordHeader, logRecordHeader+len(b))
+	r[0] = 2
+	r[1] = 'R'
+	binary.BigEndian.PutUint32(r[2:], uint32(len(b)))
+	binary.BigEndian.PutUint64(r[6:], seq)
+	binary.BigEndian.PutUint32(r[14:], crc32.Update(crc32.ChecksumIEEE(r[6:14]), crc32.IEEETable, b))
+
+	return append(r, b...)
 }
 
 // Get returns the OGDL object at the position given and the position of the
-// next object, or an error.
+// next object, or an error. At the end of the log it returns nil and -1. See
+// Iter for walking through the log.
 func (log *Log) Get(i int64) (*Graph, int64, error) {
 
-	/* Position in file */
-	_, err := log.f.Seek(i, 0)
+	if log.framed {
+		b, _, next, err := log.record(i)
+		if err == io.EOF {
+			return nil, -1, nil
+		}
+		if err != nil {
+			return nil, -1, err
+		}
+		g, err := decodeAt(b, i+logRecordHeader)
+		if err != nil {
+			return nil, -1, err
+		}
+		return g, next, nil
+	}
+
+	r, err := log.reader(i)
 	if err != nil {
 		return nil, -1, err
 	}
 
-	p := newBinParser(log.f)
-	g := p.parse()
-
-	if p.n == 0 {
-		return g, -1, nil
+	p := newBinParser(r)
+	g, err := p.decode()
+	if err == io.EOF {
+		return nil, -1, nil
+	}
+	if err != nil {
+		return nil, -1, err
 	}
 
-	return g, i + int64(p.n), err
+	return g, i + int64(p.n), nil
 }
 
 // GetBinary returns the OGDL object at the position given and the position of the
-// next object, or an error. The object returned is in binary form, exactly
-// as it is stored in the log.
+// next object, or an error. The object returned is in binary form, as it is
+// stored in the log. In framed logs, it is the data of the record, without
+// its header, as given to AddBinary.
 func (log *Log) GetBinary(i int64) ([]byte, int64, error) {
 
-	// Position in file
-	_, err := log.f.Seek(i, 0)
+	if log.framed {
+		b, _, next, err := log.record(i)
+		if err != nil {
+			return nil, 0, err
+		}
+		return b, next, nil
+	}
+
+	r, err := log.reader(i)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	/* Read until EOS of binary OGDL.
+	// Read until EOS of binary OGDL.
+	p := newBinParser(r)
+	if err = p.skip(); err != nil {
+		return nil, 0, err
+	}
 
-	   There should be a Header first.
-	*/
-	p := newBinParser(log.f)
+	// Read bytes
+	b := make([]byte, p.n)
+	_, err = r.ReadAt(b, 0)
 
-	if !p.header() {
-		return nil, 0, err
+	return b, i + int64(p.n), err
+}
+
+// Len returns the number of objects in the log, up to the first one that is
+// not well formed.
+func (log *Log) Len() int {
+	offs, _ := log.offsets()
+	return len(offs)
+}
+
+// Last returns the last object of the log and its position, or nil and -1 if
+// the log is empty.
+func (log *Log) Last() (*Graph, int64, error) {
+	offs, err := log.offsets()
+	if err != nil {
+		return nil, -1, err
+	}
+	if len(offs) == 0 {
+		return nil, -1, nil
 	}
+	i := offs[len(offs)-1]
+	g, _, err := log.Get(i)
+	return g, i, err
+}
+
+// Iter returns an iterator over the objects of the log, from the one at
+// position from to the last one:
+//
+//     it := log.Iter(0)
+//     for it.Next() {
+//         g := it.Graph()
+//         ...
+//     }
+//     if it.Err() != nil {
+//         ...
+//     }
+func (log *Log) Iter(from int64) *LogIter {
+
+	it := &LogIter{log: log, base: from}
+
+	if log.framed {
+		it.next = from
+		return it
+	}
+
+	r, err := log.reader(from)
+	if err != nil {
+		it.err = err
+		return it
+	}
+	it.d = NewBinaryDecoder(r)
+	return it
+}
+
+// IterReverse returns an iterator over the objects of the log, newest first,
+// starting with the one at position from, or the last one if from is
+// negative. The log is read once to find where each object starts.
+func (log *Log) IterReverse(from int64) *LogIter {
+
+	it := &LogIter{log: log, reverse: true}
+
+	offs, err := log.offsets()
+	if err != nil {
+		it.err = err
+		return it
+	}
+	for len(offs) > 0 && from >= 0 && offs[len(offs)-1] > from {
+		offs = offs[:len(offs)-1]
+	}
+	it.offs = offs
+	return it
+}
+
+// LogIter is an iterator over the objects of a Log, returned by Log.Iter
+// and Log.IterReverse.
+type LogIter struct {
+	log     *Log
+	reverse bool
+
+	// Forward iteration: the decoder and the position where it started, or
+	// for framed logs, the next record and the last sequence number
+	d    *BinaryDecoder
+	base int64
+	next int64
+	seq  uint64
+
+	// Reverse iteration: the positions of the objects left
+	offs []int64
+
+	g   *Graph
+	off int64
+	err error
+}
+
+// Next advances to the next object, that is then available through Graph
+// and Offset. It returns false at the end of the log or on errors.
+func (it *LogIter) Next() bool {
+
+	it.g = nil
+	if it.err != nil {
+		return false
+	}
+
+	if it.reverse {
+		if len(it.offs) == 0 {
+			return false
+		}
+		it.off = it.offs[len(it.offs)-1]
+		it.offs = it.offs[:len(it.offs)-1]
+		it.g, _, it.err = it.log.Get(it.off)
+		return it.err == nil
+	}
+
+	if it.d == nil {
+		return it.record()
+	}
+
+	it.off = it.base + int64(it.d.p.n)
+	g, err := it.d.Decode()
+	if err != nil {
+		if err != io.EOF {
+			it.err = err
+		}
+		return false
+	}
+	it.g = g
+	return true
+}
+
+// record reads the next record of a framed log, checking that its sequence
+// number follows that of the previous one.
+func (it *LogIter) record() bool {
+
+	b, seq, next, err := it.log.record(it.next)
+	if err == io.EOF {
+		return false
+	}
+	if err == nil && it.seq != 0 && seq != it.seq+1 {
+		err = &BinaryError{Offset: it.next, Err: ErrSequence}
+	}
+	if err == nil {
+		it.g, err = decodeAt(b, it.next+logRecordHeader)
+	}
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.off, it.next, it.seq = it.next, next, seq
+	return true
+}
+
+// Graph returns the current object.
+func (it *LogIter) Graph() *Graph {
+	return it.g
+}
+
+// Offset returns the position of the current object in the log.
+func (it *LogIter) Offset() int64 {
+	return it.off
+}
+
+// Err returns the error that stopped the iteration, if any. Reaching the end
+// of the log is not an error.
+func (it *LogIter) Err() error {
+	return it.err
+}
+
+// offsets returns the positions of the objects in the log, up to the first
+// one that is not well formed.
+func (log *Log) offsets() ([]int64, error) {
+
+	r, err := log.reader(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var offs []int64
+
+	if log.framed {
+		size := log.size()
+		for i := int64(0); i < size; {
+			l, _, _, err := log.header(i, size)
+			if err != nil {
+				return offs, err
+			}
+			offs = append(offs, i)
+			i += logRecordHeader + l
+		}
+		return offs, nil
+	}
+
+	p := newBinParser(r)
 	for {
-		lev, _, _ /* typ, b*/ := p.line(false)
-		if lev == 0 {
+		i := int64(p.n)
+		err = p.skip()
+		if err == io.EOF {
+			return offs, nil
+		}
+		if err != nil {
+			return offs, err
+		}
+		offs = append(offs, i)
+	}
+}
+
+// reader returns a reader of the log from position i to the end, either of
+// the file or the memory buffer. Reading doesn't move the position in the
+// file.
+func (log *Log) reader(i int64) (*io.SectionReader, error) {
+
+	end := log.size()
+	if i < 0 || i > end {
+		return nil, ErrInvalidIndex
+	}
+
+	if log.f == nil {
+		log.mu.Lock()
+		b := log.b.Bytes()[:end]
+		log.mu.Unlock()
+		return io.NewSectionReader(bytes.NewReader(b), i, end-i), nil
+	}
+	return io.NewSectionReader(log.f, i, end-i), nil
+}
+
+// size returns the length of the log, in bytes, up to the last object
+// completely written.
+func (log *Log) size() int64 {
+	return atomic.LoadInt64(&log.end)
+}
+
+// header reads the header of the record at position i of a framed log of the
+// given size. It returns the length of the data, the sequence number and the
+// checksum.
+func (log *Log) header(i, size int64) (int64, uint64, uint32, error) {
+
+	r, err := log.reader(i)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	h := make([]byte, logRecordHeader)
+	n, _ := r.ReadAt(h, 0)
+	switch {
+	case n == 0 && i == size:
+		return 0, 0, 0, io.EOF
+	case n < logRecordHeader || h[0] != 2 || h[1] != 'R':
+		return 0, 0, 0, &BinaryError{Offset: i, Err: ErrLogRecord}
+	}
+
+	l := int64(binary.BigEndian.Uint32(h[2:]))
+	if i+logRecordHeader+l > size {
+		return 0, 0, 0, &BinaryError{Offset: i, Err: ErrLogRecord}
+	}
+	return l, binary.BigEndian.Uint64(h[6:]), binary.BigEndian.Uint32(h[14:]), nil
+}
+
+// record reads the record at position i of a framed log, and checks it. It
+// returns the data, the sequence number and the position of the next record,
+// or io.EOF at the end of the log.
+func (log *Log) record(i int64) ([]byte, uint64, int64, error) {
+
+	l, seq, crc, err := log.header(i, log.size())
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	r, _ := log.reader(i)
+	b := make([]byte, logRecordHeader+l)
+	if _, err = r.ReadAt(b, 0); err != nil {
+		return nil, 0, 0, &BinaryError{Offset: i, Err: ErrLogRecord}
+	}
+	if crc32.Update(crc32.ChecksumIEEE(b[6:14]), crc32.IEEETable, b[logRecordHeader:]) != crc {
+		return nil, 0, 0, &BinaryError{Offset: i, Err: ErrChecksum}
+	}
+	return b[logRecordHeader:], seq, i + logRecordHeader + l, nil
+}
+
+// recover walks the records of a framed log, checks the last one, and
+// truncates the log after the last good record, if what follows is a torn
+// tail: a record that runs to the end of the file, or the last one, with a
+// bad checksum. The bytes removed are kept in the file name + ".torn" if
+// quarantine is set. A bad record followed by good ones is not removed: the
+// log is damaged, and the error is returned.
+func (log *Log) recover(quarantine bool) error {
+
+	size := log.size()
+
+	// Walk the headers
+	var i, last, prev int64 = 0, -1, -1
+	var err error
+	for i < size {
+		var l int64
+		var seq uint64
+		if l, seq, _, err = log.header(i, size); err != nil {
 			break
 		}
+		prev, last = last, i
+		log.seq = seq
+		i += logRecordHeader + l
 	}
 
-	n := p.n
+	// The last record could have a complete header but not its data
+	if last >= 0 && i == size {
+		if _, _, _, err = log.record(last); err != nil {
+			i = last
+			log.seq = 0
+			if prev >= 0 {
+				_, log.seq, _, _ = log.header(prev, size)
+			}
+		}
+	} else if i < size {
+		// A wrong length in the last good header also leads here, so look
+		// for good records after it
+		from := i
+		if last >= 0 {
+			from = last
+		}
+		if log.follows(from) {
+			return err
+		}
+	}
 
-	// Read bytes
-	b := make([]byte, n)
-	_, err = log.f.ReadAt(b, i)
+	if i == size {
+		return nil
+	}
+
+	log.repair = &LogRepair{Offset: i, Bytes: size - i}
+
+	if quarantine {
+		b := make([]byte, size-i)
+		if _, err := log.f.ReadAt(b, i); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(log.file+".torn", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(b)
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			return err
+		}
+		log.repair.File = log.file + ".torn"
+	}
+
+	if err := log.f.Truncate(i); err != nil {
+		return err
+	}
+	log.end, log.synced = i, i
+	return log.f.Sync()
+}
+
+// follows returns true if a good record starts after position i, which
+// means that the bad record at i is not a torn tail.
+func (log *Log) follows(i int64) bool {
+
+	size := log.size()
+	buf := make([]byte, 64*1024)
+
+	for j := i + 1; j+logRecordHeader <= size; {
+		n, _ := log.f.ReadAt(buf, j)
+		if n < 2 {
+			return false
+		}
+		k := bytes.Index(buf[:n], []byte{2, 'R'})
+		if k < 0 {
+			// The last byte could start a record
+			j += int64(n) - 1
+			continue
+		}
+		if _, _, _, err := log.record(j + int64(k)); err == nil {
+			return true
+		}
+		j += int64(k) + 1
+	}
+	return false
+}
 
-	return b, int64(n), err
+// Verify reads every object of the log and returns the first error found,
+// with its position in a *BinaryError: a malformed object or, in framed logs,
+// a record that is incomplete, has a wrong checksum or is out of sequence.
+func (log *Log) Verify() error {
+	it := log.Iter(0)
+	for it.Next() {
+	}
+	return it.Err()
+}
+
+// decodeAt decodes the binary OGDL object b, found at position i of the log.
+// Error positions are relative to the log.
+func decodeAt(b []byte, i int64) (*Graph, error) {
+	g, err := NewBinaryDecoder(bytes.NewReader(b)).Decode()
+	if be, ok := err.(*BinaryError); ok {
+		be.Offset += i
+	}
+	if err == io.EOF {
+		err = &BinaryError{Offset: i, Err: ErrBinaryTruncated}
+	}
+	return g, err
 }
@@ -0,0 +1,321 @@
+// Copyright 2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"encoding/binary"
+	"os"
+	"sort"
+	"time"
+)
+
+// The index of a log is kept in the file name + ".idx". It maps the sequence
+// number of each object to its position in the log and, optionally, to its
+// time:
+//
+//	index  ::= 'O' 'G' 'D' 'L' 'I' 'X' version flags first entry*
+//	flags  ::= byte, 1 if entries have a time
+//	first  ::= uint64, big endian, the sequence number of the first entry
+//	entry  ::= offset time
+//	offset ::= uint64, big endian
+//	time   ::= int64, big endian, in nanoseconds since 1970 (UTC)
+//
+// Sequence numbers are those of the records in framed logs, and 1, 2, 3 ...
+// in unframed ones. The index is only a cache: it is not synced to disk, and
+// it is checked against the log and brought up to date when the log is
+// opened.
+const (
+	logIndexHeader = 16
+	logIndexEntry  = 16
+)
+
+// logIndex is the open index of a log.
+type logIndex struct {
+	f     *os.File
+	times bool
+	first uint64 // Sequence number of the first entry
+	n     int64  // Number of entries
+	last  int64  // Time of the last entry
+}
+
+// openIndex opens, checks and updates the index of the log. If times is set,
+// each object is indexed with the time found at timePath.
+func (log *Log) openIndex(timePath string) error {
+
+	f, err := os.OpenFile(log.file+".idx", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	x := &logIndex{f: f, times: timePath != ""}
+	if timePath != "" {
+		log.timePath = NewPath(timePath)
+	}
+	log.idx = x
+
+	// Continue after the last entry that matches the log, or rebuild
+	from := int64(0)
+	if x.load() {
+		from = log.checkIndex()
+	}
+	if from == 0 {
+		x.n = 0
+		log.seq = 0
+	}
+	if err = f.Truncate(logIndexHeader + x.n*logIndexEntry); err != nil {
+		return err
+	}
+
+	it := log.Iter(from)
+	for it.Next() {
+		seq := log.seq + 1
+		if log.framed {
+			seq = it.seq
+		}
+		if err = log.index(seq, it.Offset(), it.Graph()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// load reads the header of the index. It returns false if the index is new,
+// damaged, or doesn't have the times asked for.
+func (x *logIndex) load() bool {
+
+	fi, err := x.f.Stat()
+	if err != nil || fi.Size() < logIndexHeader {
+		return false
+	}
+
+	h := make([]byte, logIndexHeader)
+	if _, err := x.f.ReadAt(h, 0); err != nil {
+		return false
+	}
+	if string(h[:6]) != "OGDLIX" || h[6] != 1 || (h[7] == 1) != x.times {
+		return false
+	}
+
+	x.first = binary.BigEndian.Uint64(h[8:])
+	x.n = (fi.Size() - logIndexHeader) / logIndexEntry
+	return true
+}
+
+// checkIndex drops the entries that point beyond the end of the log, and
+// checks that the last one points to an object with the right sequence
+// number. It returns the position of the object that follows the last entry,
+// or 0 if the index has to be rebuilt.
+func (log *Log) checkIndex() int64 {
+
+	x := log.idx
+	size := log.size()
+
+	for x.n > 0 {
+		off, t, err := x.entry(x.n - 1)
+		if err != nil {
+			return 0
+		}
+		if off >= size {
+			x.n--
+			continue
+		}
+
+		seq := x.first + uint64(x.n) - 1
+		if log.framed {
+			_, s, next, err := log.record(off)
+			if err != nil || s != seq {
+				return 0
+			}
+			log.seq, x.last = seq, t
+			return next
+		}
+		_, next, err := log.GetBinary(off)
+		if err != nil {
+			return 0
+		}
+		log.seq, x.last = seq, t
+		return next
+	}
+	return 0
+}
+
+// index adds an entry for the object g (which may be nil) at position off.
+func (log *Log) index(seq uint64, off int64, g *Graph) error {
+
+	x := log.idx
+
+	if x.n == 0 {
+		h := []byte("OGDLIX\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+		if x.times {
+			h[7] = 1
+		}
+		binary.BigEndian.PutUint64(h[8:], seq)
+		if _, err := x.f.WriteAt(h, 0); err != nil {
+			return err
+		}
+		x.first = seq
+	}
+
+	t := x.last
+	if x.times {
+		if g == nil {
+			b, _, err := log.GetBinary(off)
+			if err == nil {
+				g = FromBinary(b)
+			}
+		}
+		n, _ := g.getPath(log.timePath)
+		t = logTime(n)
+		if t < x.last {
+			t = x.last
+		}
+	}
+
+	e := make([]byte, logIndexEntry)
+	binary.BigEndian.PutUint64(e, uint64(off))
+	binary.BigEndian.PutUint64(e[8:], uint64(t))
+	if _, err := x.f.WriteAt(e, logIndexHeader+x.n*logIndexEntry); err != nil {
+		return err
+	}
+
+	log.seq = seq
+	x.n++
+	x.last = t
+	return nil
+}
+
+// dropIndex stops using the index after an error writing it, as its entries
+// would no longer match the objects. Without index, GetSeq reads the log, and
+// SeekTime returns the error. The index is brought up to date when the log
+// is opened again. It is called with mu held.
+func (log *Log) dropIndex(err error) {
+	log.idx.f.Close()
+	log.idx = nil
+	log.idxErr = err
+}
+
+// entry returns the position and time of entry i.
+func (x *logIndex) entry(i int64) (int64, int64, error) {
+	e := make([]byte, logIndexEntry)
+	if _, err := x.f.ReadAt(e, logIndexHeader+i*logIndexEntry); err != nil {
+		return 0, 0, err
+	}
+	return int64(binary.BigEndian.Uint64(e)), int64(binary.BigEndian.Uint64(e[8:])), nil
+}
+
+// logTime returns the time held by the node found at the time path of the
+// index: a time.Time, or a string in RFC 3339 format. It returns 0 if there
+// is no time.
+func logTime(n *Graph) int64 {
+
+	if n == nil || n.Len() == 0 {
+		return 0
+	}
+
+	switch v := n.Out[0].This.(type) {
+	case time.Time:
+		return v.UnixNano()
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err == nil {
+			return t.UnixNano()
+		}
+	}
+	return 0
+}
+
+// GetSeq returns the object with the given sequence number, and its position
+// in the log. Sequence numbers are those of the records of framed logs, and
+// start at 1 in unframed logs. Without an index (see LogOptions), the log is
+// read from the start to find the object.
+func (log *Log) GetSeq(n uint64) (*Graph, int64, error) {
+
+	off, err := log.seqOffset(n)
+	if err != nil {
+		return nil, -1, err
+	}
+	g, _, err := log.Get(off)
+	return g, off, err
+}
+
+// seqOffset returns the position of the object with sequence number n.
+func (log *Log) seqOffset(n uint64) (int64, error) {
+
+	// The index is read with mu held, so that it is not dropped meanwhile
+	log.mu.Lock()
+	if x := log.idx; x != nil {
+		defer log.mu.Unlock()
+		if n < x.first || n-x.first >= uint64(x.n) {
+			return 0, ErrNotFound
+		}
+		off, _, err := x.entry(int64(n - x.first))
+		return off, err
+	}
+	log.mu.Unlock()
+
+	offs, err := log.offsets()
+	if err != nil {
+		return 0, err
+	}
+	first := uint64(1)
+	if log.framed && len(offs) > 0 {
+		_, first, _, _ = log.header(offs[0], log.size())
+	}
+	if n < first || n-first >= uint64(len(offs)) {
+		return 0, ErrNotFound
+	}
+	return offs[n-first], nil
+}
+
+// SeekTime returns an iterator over the objects of the log from the first one
+// with a time equal to or after t. It needs an index with times (see
+// LogOptions.IndexTime). Times are expected not to decrease along the log;
+// an object with an earlier time, or without one, is indexed with the time of
+// the object before it. If the index was dropped after an error, that error
+// is returned by the iterator.
+func (log *Log) SeekTime(t time.Time) *LogIter {
+	off, err := log.timeOffset(t)
+	if err != nil {
+		return &LogIter{log: log, err: err}
+	}
+	return log.Iter(off)
+}
+
+// timeOffset returns the position of the first object with a time equal to
+// or after t, or the size of the log if there is none.
+func (log *Log) timeOffset(t time.Time) (int64, error) {
+
+	// The index is read with mu held, so that it is not dropped meanwhile
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	x := log.idx
+	switch {
+	case x == nil && log.idxErr != nil:
+		return 0, log.idxErr
+	case x == nil || !x.times:
+		return 0, ErrNoTimeIndex
+	}
+
+	var err error
+	tn := t.UnixNano()
+	i := sort.Search(int(x.n), func(i int) bool {
+		_, ti, e := x.entry(int64(i))
+		if e != nil {
+			err = e
+			return true
+		}
+		return ti >= tn
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if int64(i) == x.n {
+		return log.size(), nil
+	}
+	off, _, err := x.entry(int64(i))
+	return off, err
+}
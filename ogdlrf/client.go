@@ -29,6 +29,9 @@ type Client struct {
 	conn     net.Conn
 	Timeout  int
 	Protocol int
+	// Types selects the typed binary format for requests (see
+	// ogdl.Graph.BinaryTypes). Servers answer in the format of the request.
+	Types bool
 }
 
 // Dial opens the TCP connection
@@ -78,7 +81,7 @@ func (rf *Client) Call(g *ogdl.Graph) (*ogdl.Graph, error) {
 func (rf *Client) callV2(g *ogdl.Graph) (*ogdl.Graph, error) {
 
 	// Convert graph to []byte
-	buf := g.Binary()
+	buf := rf.binary(g)
 
 	// Send LEN
 	b4 := make([]byte, 4)
@@ -142,7 +145,7 @@ func (rf *Client) callV1(g *ogdl.Graph) (*ogdl.Graph, error) {
 
 	rf.conn.SetDeadline(time.Now().Add(time.Second * 10))
 
-	b := g.Binary()
+	b := rf.binary(g)
 	n, err := rf.conn.Write(b)
 
 	if err != nil {
@@ -173,3 +176,11 @@ func (rf *Client) Close() {
 		rf.conn = nil
 	}
 }
+
+// binary returns g in the binary format selected by Types.
+func (rf *Client) binary(g *ogdl.Graph) []byte {
+	if rf.Types {
+		return g.BinaryTypes()
+	}
+	return g.Binary()
+}
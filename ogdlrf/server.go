@@ -5,6 +5,7 @@
 package ogdlrf
 
 import (
+	"bufio"
 	"encoding/binary"
 	"log"
 	"net"
@@ -163,8 +164,12 @@ func process(c net.Conn, handler Function, timeout int) {
 		}
 		r := handler(c, g)
 
-		// Write message back
-		buf = r.Binary()
+		// Write message back, in the format of the request
+		if ogdl.IsBinaryTypes(buf) {
+			buf = r.BinaryTypes()
+		} else {
+			buf = r.Binary()
+		}
 		binary.BigEndian.PutUint32(b4, uint32(len(buf)))
 
 		i, err = c.Write(b4)
@@ -191,13 +196,16 @@ func process(c net.Conn, handler Function, timeout int) {
 func process1(c net.Conn, handler Function, timeout int) {
 
 	defer c.Close()
+	br := bufio.NewReader(c)
 
 	for {
 		// Set a time out (maximum time until next message)
 		c.SetReadDeadline(time.Now().Add(time.Second * time.Duration(timeout)))
 
 		// Read the incoming object
-		g := ogdl.FromBinaryReader(c)
+		h, _ := br.Peek(3)
+		typed := ogdl.IsBinaryTypes(h)
+		g := ogdl.FromBinaryBufioReader(br)
 
 		if g == nil {
 			break
@@ -205,8 +213,13 @@ func process1(c net.Conn, handler Function, timeout int) {
 
 		r := handler(c, g)
 
-		// Write result in binary format
-		b := r.Binary()
+		// Write result in binary format, as the request
+		var b []byte
+		if typed {
+			b = r.BinaryTypes()
+		} else {
+			b = r.Binary()
+		}
 		i, err := c.Write(b)
 
 		if err != nil {
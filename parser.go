@@ -7,22 +7,38 @@ package ogdl
 import (
 	"bytes"
 	"io"
+	"io/fs"
 	"io/ioutil"
 )
 
 // Parser embeds Lexer and holds some state
 type Parser struct {
-	Lexer                     // Buffered byte and rune readed
-	ev    *SimpleEventHandler // The output (event) stream
+	Lexer              // Buffered byte and rune readed
+	ev    EventHandler // The output (event) stream
+	file  string       // File name, used in error messages
+	perr  *ParseError  // First syntax error found
+	track bool         // Whether to track positions
+	fsys  fs.FS        // File system for !include directives, if enabled
+	stack []string     // Files that include this one
+
+	types     bool             // Whether unquoted strings are converted to Go types
+	resolvers []ScalarResolver // Used by OgdlTypes, see RegisterScalar
 }
 
 // NewParser return a new Parser from a Reader
 func NewParser(rd io.Reader) *Parser {
+	return NewParserWithHandler(rd, &SimpleEventHandler{})
+}
+
+// NewParserWithHandler returns a new Parser from a Reader, that sends the
+// parse events to the given handler instead of building a Graph. This allows
+// processing streams that do not fit in memory.
+func NewParserWithHandler(rd io.Reader, ev EventHandler) *Parser {
 	p := Parser{}
 	p.rd = rd
 	p.lastByte = bufSize
 	p.buf = make([]byte, bufSize)
-	p.ev = &SimpleEventHandler{}
+	p.ev = ev
 	p.r = -1
 	p.fill()
 	return &p
@@ -38,13 +54,24 @@ func NewStringParser(s string) *Parser {
 	return NewParser(bytes.NewBuffer([]byte(s)))
 }
 
-// Graph returns the parser tree
+// Graph returns the parser tree, or nil if the event handler doesn't build
+// one (it should have a Tree() *Graph method).
 func (p *Parser) Graph() *Graph {
-	return p.ev.Tree()
+	if t, ok := p.ev.(interface{ Tree() *Graph }); ok {
+		return t.Tree()
+	}
+	return nil
 }
 
-// Handler returns the event handler being used
+// Handler returns the event handler being used, if it is the default one.
+// See EventHandler.
 func (p *Parser) Handler() *SimpleEventHandler {
+	e, _ := p.ev.(*SimpleEventHandler)
+	return e
+}
+
+// EventHandler returns the event handler being used.
+func (p *Parser) EventHandler() EventHandler {
 	return p.ev
 }
 
@@ -91,6 +118,88 @@ func FromFile(s string) *Graph {
 	return p.Graph()
 }
 
+// SetFile sets the file name used in positions and error messages.
+func (p *Parser) SetFile(name string) {
+	p.file = name
+}
+
+// TrackPositions makes the parser record the source position of each node.
+// Call it before parsing. The positions are returned by Positions(). Custom
+// event handlers receive them if they implement PositionHandler.
+func (p *Parser) TrackPositions() {
+	p.track = true
+	if e := p.Handler(); e != nil {
+		e.track = true
+	}
+}
+
+// Positions returns the source position of the nodes returned by Graph()
+// or Parse(), or nil if TrackPositions has not been called.
+func (p *Parser) Positions() *Positions {
+	if e := p.Handler(); e != nil {
+		return e.Positions()
+	}
+	return nil
+}
+
+// Parse parses the OGDL text and returns the resulting graph, or an error
+// if the text is not well formed. With a custom event handler that doesn't
+// build a tree, the graph returned is nil. If includes have been enabled
+// (see Includes), the !include directives are processed.
+func (p *Parser) Parse() (*Graph, error) {
+	return p.result(p.parse(false))
+}
+
+// ParseTypes is Parse, but converting unquoted strings to Go types, as
+// OgdlTypes does.
+func (p *Parser) ParseTypes() (*Graph, error) {
+	return p.result(p.parse(true))
+}
+
+// result returns the graph built, after processing includes.
+func (p *Parser) result(err error) (*Graph, error) {
+	if err != nil {
+		return nil, err
+	}
+	g := p.Graph()
+	if p.fsys != nil && g != nil {
+		if err = p.include(g); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Parse parses OGDL text coming from a generic io.Reader. Contrary to
+// FromReader, it returns an error if the text is not well formed. The error
+// is a *ParseError, which holds the position of the problem.
+func Parse(r io.Reader) (*Graph, error) {
+	return NewParser(r).Parse()
+}
+
+// ParseBytes parses OGDL text contained in a byte array. See Parse.
+func ParseBytes(b []byte) (*Graph, error) {
+	return Parse(bytes.NewBuffer(b))
+}
+
+// ParseString parses OGDL text from the given string. See Parse.
+func ParseString(s string) (*Graph, error) {
+	return Parse(bytes.NewBuffer([]byte(s)))
+}
+
+// ParseFile parses OGDL text contained in a file. See Parse. Parse errors
+// include the file name.
+func ParseFile(s string) (*Graph, error) {
+	b, err := ioutil.ReadFile(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewParser(bytes.NewBuffer(b))
+	p.SetFile(s)
+	return p.Parse()
+}
+
 // Some usefull functions to extended the Parser and use it in other places
 
 // Emit outputs a string event at the current level. This will show up in the graph
@@ -1,7 +1,9 @@
 package ogdl
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -31,6 +33,16 @@ func TestParser(t *testing.T) {
 
 		{"a \\\n  b\n  c", "a\n  \"b\n  c\""},
 		{"a \\\n  b c", "a\n  \"b c\""},
+		{"a\n  b \\\n    x\n  c", "a\n  b\n    x\n  c"},
+
+		// Flow syntax
+
+		{"a (b c, d e), f", "a\n  b\n    c\n  d\n    e\nf"},
+		{"a b, c d", "a\n  b\nc\n  d"},
+		{"a (b c) d", "a\n  b\n    c\n  d"},
+		{"a b (c, d)\n  e", "a\n  b\n    c\n    d\n  e"},
+		{"a ('x, y', z)", "a\n  \"x, y\"\n  z"},
+		{"f(x) 1,5", "f(x)\n  \"1,5\""},
 	}
 
 	for _, tc := range cases {
@@ -44,3 +56,114 @@ func TestParser(t *testing.T) {
 	}
 
 }
+
+func TestParseError(t *testing.T) {
+
+	cases := []struct {
+		in      string
+		err     error
+		line    int
+		col     int
+		snippet string
+	}{
+		{"a\n  b 'c", ErrUnterminatedQuotedString, 2, 5, "  b 'c"},
+		{"a\n \tb", ErrSpaceNotUniform, 2, 1, " \tb"},
+		{"  a\n  b\nc", ErrInvalidIndentation, 3, 1, "c"},
+		{"a\x01b", ErrUnexpectedChar, 1, 2, "a\x01b"},
+		{"a\nb (c, d", ErrUnbalancedParens, 2, 3, "b (c, d"},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%q", tc.in), func(t *testing.T) {
+			g, err := ParseString(tc.in)
+			if g != nil {
+				t.Error("graph returned on error")
+			}
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("got %v; want a *ParseError", err)
+			}
+			if !errors.Is(err, tc.err) || perr.Line != tc.line || perr.Column != tc.col || perr.Snippet != tc.snippet {
+				t.Errorf("got %v (%q); want %d:%d: %v", err, perr.Snippet, tc.line, tc.col, tc.err)
+			}
+		})
+	}
+
+	g, err := ParseString("a b\n  c 'd e'\n")
+	if err != nil || g.Text() != "a\n  b\n  c\n    \"d e\"" {
+		t.Error("ParseString", err, g.Text())
+	}
+
+	// Positions after the first buffer fill
+	s := strings.Repeat("abcdefghijk\n", 1000) + "x 'y"
+	_, err = ParseString(s)
+	if perr, ok := err.(*ParseError); !ok || perr.Line != 1001 || perr.Column != 3 || perr.Offset != 12002 {
+		t.Error("ParseError on long input", err)
+	}
+}
+
+func TestPositions(t *testing.T) {
+
+	p := NewStringParser("eth0\n  ip 192.168.1.1\n  # comment\n  mask \\\n    255.0\n")
+	p.SetFile("conf.ogdl")
+	p.TrackPositions()
+
+	g, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := p.Positions()
+
+	eth0 := g.Node("eth0")
+
+	cases := []struct {
+		node *Graph
+		want string
+	}{
+		{eth0, "conf.ogdl:1:1"},
+		{eth0.Node("ip"), "conf.ogdl:2:3"},
+		{eth0.Node("ip").GetAt(0), "conf.ogdl:2:6"},
+		{eth0.Node("mask"), "conf.ogdl:4:3"},
+		{eth0.Node("mask").GetAt(0), "conf.ogdl:4:8"},
+	}
+
+	for _, tc := range cases {
+		if got := pos.Pos(tc.node).String(); got != tc.want {
+			t.Errorf("%s: got %s; want %s", tc.node.ThisString(), got, tc.want)
+		}
+	}
+
+	if pos.Len() != 5 || pos.Pos(g).IsValid() {
+		t.Error("Positions table", pos.Len())
+	}
+}
+
+// countHandler counts the nodes at each level, without building a tree.
+type countHandler struct {
+	level  int
+	counts map[int]int
+}
+
+func (h *countHandler) Add(s string)         { h.counts[h.level]++ }
+func (h *countHandler) AddItf(i interface{}) { h.counts[h.level]++ }
+func (h *countHandler) Inc()                 { h.level++ }
+func (h *countHandler) Dec()                 { h.level-- }
+func (h *countHandler) Level() int           { return h.level }
+func (h *countHandler) SetLevel(l int)       { h.level = l }
+
+func TestEventHandler(t *testing.T) {
+
+	h := &countHandler{counts: map[int]int{}}
+	p := NewParserWithHandler(strings.NewReader("a b\n  c -{x} d\ne +{x}"), h)
+
+	g, err := p.Parse()
+	if err != nil || g != nil {
+		t.Fatal("Parse with custom handler", g, err)
+	}
+	if h.counts[0] != 2 || h.counts[1] != 3 || h.counts[2] != 1 {
+		t.Error("event counts", h.counts)
+	}
+	if p.Handler() != nil || p.EventHandler() != h {
+		t.Error("Handler")
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"fmt"
+)
+
+// Position is a location in OGDL text.
+type Position struct {
+	File   string // File name, if known
+	Offset int64  // Byte offset from the start of the stream
+	Line   int    // Line number, starting at 1
+	Column int    // Column (in bytes), starting at 1
+}
+
+// IsValid returns true if the position is known.
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+// String returns the position in the form file:line:column, or line:column
+// if the file name is not known.
+func (pos Position) String() string {
+	s := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	if pos.File != "" {
+		s = pos.File + ":" + s
+	}
+	return s
+}
+
+// Positions is a side table holding the source position of the nodes
+// created by a Parser, so that the Graph itself doesn't need to store them.
+// See Parser.TrackPositions.
+type Positions struct {
+	nodes map[*Graph]Position
+}
+
+// Pos returns the position in the source text of the given node. For nodes
+// not created by the parser an invalid (zero) Position is returned.
+func (ps *Positions) Pos(n *Graph) Position {
+	if ps == nil {
+		return Position{}
+	}
+	return ps.nodes[n]
+}
+
+// Len returns the number of nodes in the table.
+func (ps *Positions) Len() int {
+	if ps == nil {
+		return 0
+	}
+	return len(ps.nodes)
+}
+
+// ParseError is returned by the Parse* functions when the OGDL text is not
+// well formed. It holds the position at which the problem was detected.
+type ParseError struct {
+	Position
+	Snippet string // The offending line
+	Err     error  // The underlying error
+}
+
+// Error returns the error in the form file:line:column: message
+func (e *ParseError) Error() string {
+	return e.Position.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error, so that errors.Is can be used
+// with ErrSpaceNotUniform and friends.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// mark is a known position in the stream: an offset, the line number at
+// that offset (starting at 0) and the offset at which that line begins.
+type mark struct {
+	off     int64
+	line    int
+	lineOff int64
+}
+
+// offset returns the absolute position of the lexer in the stream.
+func (p *Lexer) offset() int64 {
+	r := p.r
+	if r > p.lastByte {
+		r = p.lastByte
+	}
+	if r < 0 {
+		r = 0
+	}
+	return p.base.off + int64(r)
+}
+
+// discard is called by fill() before the first half of the buffer is
+// overwritten. It keeps the line count of the discarded bytes.
+func (p *Lexer) discard(n int) {
+	for i := 0; i < n; i++ {
+		if p.buf[i] == '\n' {
+			p.base.line++
+			p.base.lineOff = p.base.off + int64(i) + 1
+		}
+	}
+	p.base.off += int64(n)
+}
+
+// mark returns the line information for the given offset. The last result
+// is cached, so that walking forward through the stream costs O(n).
+// Offsets that are no longer in the buffer are clamped to the oldest
+// buffered byte.
+func (p *Lexer) mark(off int64) mark {
+	if off < p.base.off {
+		off = p.base.off
+	}
+
+	m := p.last
+	if m.off < p.base.off || m.off > off {
+		m = p.base
+	}
+
+	end := int(off - p.base.off)
+	if end > p.lastByte {
+		end = p.lastByte
+	}
+
+	for i := int(m.off - p.base.off); i < end; i++ {
+		if p.buf[i] == '\n' {
+			m.line++
+			m.lineOff = p.base.off + int64(i) + 1
+		}
+	}
+	m.off = off
+	p.last = m
+	return m
+}
+
+// snippet returns the buffered part of the line that starts at lineOff.
+func (p *Lexer) snippet(lineOff int64) string {
+	i := int(lineOff - p.base.off)
+	if i < 0 {
+		i = 0
+	}
+	j := i
+	for j < p.lastByte && !IsBreakChar(p.buf[j]) {
+		j++
+	}
+	return string(p.buf[i:j])
+}
+
+// position returns the Position of the given offset.
+func (p *Parser) position(off int64) Position {
+	m := p.mark(off)
+	return Position{
+		File:   p.file,
+		Offset: m.off,
+		Line:   m.line + 1,
+		Column: int(m.off-m.lineOff) + 1,
+	}
+}
+
+// newParseError returns a ParseError for the given offset.
+func (p *Parser) newParseError(off int64, err error) *ParseError {
+	pos := p.position(off)
+	return &ParseError{
+		Position: pos,
+		Snippet:  p.snippet(pos.Offset - int64(pos.Column) + 1),
+		Err:      err,
+	}
+}
+
+// at tells the event handler where the next item begins, if positions are
+// being tracked.
+func (p *Parser) at(off int64) {
+	if !p.track {
+		return
+	}
+	if h, ok := p.ev.(PositionHandler); ok {
+		h.SetPosition(p.position(off))
+	}
+}
+
+// fail records the first syntax error found. Parsing continues as before,
+// so that the non error returning functions keep producing the same graph.
+func (p *Parser) fail(off int64, err error) {
+	if p.perr == nil {
+		p.perr = p.newParseError(off, err)
+	}
+}
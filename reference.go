@@ -0,0 +1,124 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"strconv"
+)
+
+// OGDL level 2 allows a node to appear in more than one place, and thus
+// graphs with cycles. In text form, the first occurrence of such a node is
+// labelled with an anchor, -{name}, and the following ones are written as
+// references, +{name}:
+//
+//    link1
+//      -{1} router1
+//        ip 10.0.0.1
+//    link2
+//      +{1}
+//
+// Only nodes with subnodes are given anchors. A shared leaf node is written
+// as a value wherever it appears.
+
+// refs holds the state needed to write a graph that has shared nodes, so
+// that they are written once, and cycles do not cause infinite recursion.
+type refs struct {
+	names map[*Graph]string // Shared nodes, and their anchor name once assigned
+	path  map[*Graph]bool   // Shared nodes being written (used to cut cycles)
+	n     int               // Last anchor number assigned
+}
+
+// newRefs walks the graph and returns the shared nodes found. It returns nil
+// if the graph is a tree.
+func newRefs(g *Graph) *refs {
+	if g == nil {
+		return nil
+	}
+
+	seen := map[*Graph]bool{g: true}
+	var names map[*Graph]string
+
+	var walk func(g *Graph)
+	walk = func(g *Graph) {
+		for _, n := range g.Out {
+			if n == nil || len(n.Out) == 0 {
+				continue
+			}
+			if seen[n] {
+				if names == nil {
+					names = make(map[*Graph]string)
+				}
+				names[n] = ""
+				continue
+			}
+			seen[n] = true
+			walk(n)
+		}
+	}
+	walk(g)
+
+	if names == nil {
+		return nil
+	}
+	return &refs{names: names, path: make(map[*Graph]bool)}
+}
+
+// name returns the anchor name of a shared node, assigning one if this is
+// the first time the node is written. Names are consecutive numbers, in order
+// of appearance.
+func (r *refs) name(g *Graph) string {
+	name := r.names[g]
+	if name == "" {
+		r.n++
+		name = strconv.Itoa(r.n)
+		r.names[g] = name
+	}
+	return name
+}
+
+// visit is called before writing node g as OGDL text. If g is a shared node
+// it returns its anchor name, and true if it has been written before, in which
+// case a reference should be written instead.
+func (r *refs) visit(g *Graph) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	name, ok := r.names[g]
+	if !ok {
+		return "", false
+	}
+	if name != "" {
+		return name, true
+	}
+	return r.name(g), false
+}
+
+// enter is used by the emitters of formats that cannot represent shared
+// nodes (JSON and binary). Shared nodes are written at each occurrence, but
+// a node that is already being written closes a cycle. In that case, enter
+// returns false and the reference that should be written instead, using the
+// same anchor name as Text() would. Otherwise, exit must be called when the
+// node has been written.
+func (r *refs) enter(g *Graph) (string, bool) {
+	if r == nil {
+		return "", true
+	}
+	if _, ok := r.names[g]; !ok {
+		return "", true
+	}
+	name := r.name(g)
+	if r.path[g] {
+		return "+{" + name + "}", false
+	}
+	r.path[g] = true
+	return "", true
+}
+
+// exit marks a node as written. See enter.
+func (r *refs) exit(g *Graph) {
+	if r != nil {
+		delete(r.path, g)
+	}
+}
@@ -0,0 +1,101 @@
+package ogdl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReferenceParse(t *testing.T) {
+
+	g, err := ParseString("link1\n  -{r1} router1\n    ip 10.0.0.1\nlink2\n  +{r1}\nname '+{r1}'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r1 := g.Get("link1").GetAt(0)
+	r2 := g.Get("link2").GetAt(0)
+	if r1 == nil || r1 != r2 || r1.ThisString() != "router1" {
+		t.Fatal("reference does not point to the anchored node")
+	}
+	if g.Get("name").String() != "+{r1}" {
+		t.Error("quoted reference should be a string")
+	}
+
+	// Shared nodes are written once, with an anchor.
+	s := g.Text()
+	want := "link1\n  -{1} router1\n    ip\n      10.0.0.1\nlink2\n  +{1}\nname\n  \"+{r1}\""
+	if s != want {
+		t.Errorf("got %s; want %s", s, want)
+	}
+
+	g2 := FromString(s)
+	if g2.Get("link2").GetAt(0) != g2.Get("link1").GetAt(0) || !g.Equals(g2) {
+		t.Error("Text() round trip")
+	}
+
+	_, err = ParseString("a +{x}")
+	if err == nil || !strings.Contains(err.Error(), ErrUndefinedReference.Error()) {
+		t.Error("undefined reference", err)
+	}
+	_, err = ParseString("a -{x}\nb")
+	if err == nil || !strings.Contains(err.Error(), ErrDanglingAnchor.Error()) {
+		t.Error("dangling anchor", err)
+	}
+}
+
+func TestReferenceCycle(t *testing.T) {
+
+	g := FromString("-{a} a\n  b\n    +{a}")
+	a := g.GetAt(0)
+	if a.GetAt(0).GetAt(0) != a {
+		t.Fatal("cycle not built")
+	}
+
+	if s := g.Text(); s != "-{1} a\n  b\n    +{1}" {
+		t.Error("Text", s)
+	}
+	if s := g.Show(); s != "_\n  -{1} a\n    b\n      +{1}" {
+		t.Error("Show", s)
+	}
+
+	c := g.Clone()
+	ca := c.GetAt(0)
+	if ca == a || ca.GetAt(0).GetAt(0) != ca {
+		t.Error("Clone")
+	}
+	if !g.Equals(c) {
+		t.Error("Equals")
+	}
+
+	d := New("_")
+	d.Copy(g)
+	if !g.Equals(d) {
+		t.Error("Copy")
+	}
+
+	if s := string(g.JSON()); !strings.Contains(s, "+{1}") {
+		t.Error("JSON", s)
+	}
+
+	b := FromBinary(g.Binary())
+	if s := b.Text(); s != "a\n  b\n    \"+{1}\"" {
+		t.Error("Binary", s)
+	}
+}
+
+func TestReferencePosition(t *testing.T) {
+
+	p := NewStringParser("a\n  -{x} b\nc\n  +{x}")
+	p.TrackPositions()
+
+	g, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The shared node is where the anchor is, not the reference.
+	b := g.Node("c").GetAt(0)
+	if s := p.Positions().Pos(b).String(); s != "2:8" {
+		t.Error("position of shared node", s)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2012-2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScalarResolver converts an unquoted string found in OGDL text to a Go
+// value. It returns false if the string is not of the type it handles.
+type ScalarResolver func(string) (interface{}, bool)
+
+// StandardScalars is a set of resolvers for time.Time, time.Duration,
+// hexadecimal, octal and binary integers, byte sizes and null. Enable it with
+//
+//	p.RegisterScalar(ogdl.StandardScalars...)
+var StandardScalars = []ScalarResolver{
+	ResolveTime,
+	ResolveDuration,
+	ResolveInt,
+	ResolveByteSize,
+	ResolveNull,
+}
+
+// RegisterScalar adds resolvers that are used by OgdlTypes and ParseTypes,
+// before the default conversions to int64, float64 and bool. Resolvers are
+// tried in the order in which they were registered. Quoted strings are not
+// converted.
+func (p *Parser) RegisterScalar(r ...ScalarResolver) {
+	p.resolvers = append(p.resolvers, r...)
+}
+
+// ResolveTime converts RFC 3339 dates, as 2006-01-02T15:04:05Z, to time.Time.
+func ResolveTime(s string) (interface{}, bool) {
+	if len(s) < 20 || s[4] != '-' {
+		return nil, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return t, err == nil
+}
+
+// ResolveDuration converts durations, as 5s or 2h30m, to time.Duration.
+func ResolveDuration(s string) (interface{}, bool) {
+	// Plain numbers are not durations
+	if len(s) == 0 {
+		return nil, false
+	}
+	if c := s[len(s)-1]; c < 'a' || c > 'z' {
+		return nil, false
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil
+}
+
+// ResolveInt converts integers with a 0x, 0o or 0b prefix to int64.
+func ResolveInt(s string) (interface{}, bool) {
+	t := strings.TrimLeft(s, "+-")
+	if len(t) < 3 || t[0] != '0' || !strings.ContainsRune("xXoObB", rune(t[1])) {
+		return nil, false
+	}
+	i, err := strconv.ParseInt(s, 0, 64)
+	return i, err == nil
+}
+
+// byteUnits holds the multipliers of byte sizes, SI and binary.
+var byteUnits = map[string]float64{
+	"B":   1,
+	"kB":  1e3,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"PB":  1e15,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+	"PiB": 1 << 50,
+}
+
+// ResolveByteSize converts byte sizes, as 10MB or 1.5GiB, to an int64
+// number of bytes.
+func ResolveByteSize(s string) (interface{}, bool) {
+	i := strings.IndexAny(s, "BkKMGTP")
+	if i < 1 {
+		return nil, false
+	}
+	m, ok := byteUnits[s[i:]]
+	if !ok {
+		return nil, false
+	}
+	f, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || f < 0 {
+		return nil, false
+	}
+	return int64(f * m), true
+}
+
+// ResolveNull converts null to nil.
+func ResolveNull(s string) (interface{}, bool) {
+	return nil, s == "null"
+}
+
+// _time converts an interface{} to a time.Time, if it is one or is a string
+// in RFC 3339 format.
+func _time(i interface{}) (time.Time, bool) {
+	if g, ok := i.(*Graph); ok && g != nil {
+		i = g.This
+	}
+	switch v := i.(type) {
+	case time.Time:
+		return v, true
+	case string, []byte:
+		t, err := time.Parse(time.RFC3339Nano, _string(v))
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// _duration converts an interface{} to a time.Duration, if it is one or is
+// a string that can be parsed as one.
+func _duration(i interface{}) (time.Duration, bool) {
+	if g, ok := i.(*Graph); ok && g != nil {
+		i = g.This
+	}
+	switch v := i.(type) {
+	case time.Duration:
+		return v, true
+	case string, []byte:
+		d, err := time.ParseDuration(_string(v))
+		return d, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,602 @@
+// Copyright 2025, Rolf Veen and contributors.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ogdl
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SegmentedLog is a log kept in a directory as a series of Log files, the
+// segments. Objects are added to the last segment, until it reaches a size or
+// an age, and then a new one is started. Old segments are deleted following a
+// retention policy, and can be compacted by key.
+//
+// The segments are listed in the file MANIFEST of the directory, in OGDL:
+//
+//	segments
+//	  1 2025-01-01T00:00:00Z
+//	  2 2025-01-02T00:00:00Z
+//
+// with the number of each segment, that gives its file name (1 is
+// 0000000001.log), and the time at which it was started.
+//
+// Positions in a SegmentedLog are LogPos values. Compaction moves objects, so
+// positions should not be kept beyond it; use Iter to walk the log.
+//
+// A SegmentedLog can be used from several goroutines at once. Objects are
+// added concurrently, as in a Log, while starting a segment, deleting
+// segments and compacting wait for the objects being added. Iterating over
+// a segment that is deleted or compacted meanwhile ends with an error.
+type SegmentedLog struct {
+	dir  string
+	opts SegmentOptions
+
+	// mu protects segs and cur. It is held for reading while objects are
+	// added or read, and for writing while segments are started, deleted or
+	// compacted. cmu protects closed. kmu serializes compactions, as the
+	// positions found by one are no longer valid after another.
+	mu     sync.RWMutex
+	segs   []segment // Oldest first
+	cur    *Log      // The last segment
+	cmu    sync.Mutex
+	closed map[uint64]*Log // Segments before the last one, open for reading
+	kmu    sync.Mutex
+}
+
+// SegmentOptions are the options of OpenSegmentedLog. A nil *SegmentOptions
+// selects the defaults: a single segment that grows forever.
+type SegmentOptions struct {
+	MaxSize     int64         // Start a new segment when the last one reaches this size, in bytes
+	MaxAge      time.Duration // Start a new segment when the last one is this old
+	MaxSegments int           // Delete the oldest segments beyond this number
+	Retention   time.Duration // Delete segments that were closed longer ago than this
+	Log         LogOptions    // The options of each segment
+}
+
+// LogPos is the position of an object in a SegmentedLog.
+type LogPos struct {
+	Segment uint64 // Segment number
+	Offset  int64  // Position in the segment
+}
+
+// segment is an entry of the manifest.
+type segment struct {
+	id      uint64
+	created time.Time
+}
+
+// OpenSegmentedLog opens the log in the given directory. If the directory or
+// the log don't exist, they are created. Segments beyond the retention policy
+// are deleted.
+func OpenSegmentedLog(dir string, opts *SegmentOptions) (*SegmentedLog, error) {
+
+	if opts == nil {
+		opts = &SegmentOptions{}
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	l := &SegmentedLog{dir: dir, opts: *opts, closed: make(map[uint64]*Log)}
+
+	if err := l.readManifest(); err != nil {
+		return nil, err
+	}
+	if len(l.segs) == 0 {
+		l.segs = []segment{{1, time.Now()}}
+		if err := l.writeManifest(); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	l.cur, err = l.open(l.segs[len(l.segs)-1].id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = l.retain(); err != nil {
+		l.cur.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close closes the log.
+func (l *SegmentedLog) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cur.Close()
+	for _, s := range l.segs {
+		l.forget(s.id)
+	}
+}
+
+// Add adds an object to the log, starting a new segment first if the last
+// one is full or too old. It returns the position of the object. Errors are
+// returned as in Log.AddErr.
+func (l *SegmentedLog) Add(g *Graph) (LogPos, error) {
+
+	l.mu.RLock()
+	for l.full() {
+		l.mu.RUnlock()
+		l.mu.Lock()
+		err := l.roll()
+		l.mu.Unlock()
+		if err != nil {
+			return LogPos{}, err
+		}
+		l.mu.RLock()
+	}
+	defer l.mu.RUnlock()
+
+	id := l.segs[len(l.segs)-1].id
+	off, err := l.cur.AddErr(g)
+	if off < 0 {
+		return LogPos{}, err
+	}
+	return LogPos{id, off}, err
+}
+
+// Get returns the object at the given position.
+func (l *SegmentedLog) Get(pos LogPos) (*Graph, error) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	log, err := l.segment(pos.Segment)
+	if err != nil {
+		return nil, err
+	}
+
+	g, _, err := log.Get(pos.Offset)
+	if err == nil && g == nil {
+		err = ErrNotFound
+	}
+	return g, err
+}
+
+// Segments returns the numbers of the segments, oldest first.
+func (l *SegmentedLog) Segments() []uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	ids := make([]uint64, len(l.segs))
+	for i, s := range l.segs {
+		ids[i] = s.id
+	}
+	return ids
+}
+
+// Iter returns an iterator over the objects of the log, starting at the given
+// position, or at the oldest object if from is the zero LogPos, or its segment
+// is gone.
+func (l *SegmentedLog) Iter(from LogPos) *SegmentIter {
+	return &SegmentIter{l: l, from: from}
+}
+
+// SegmentIter is an iterator over the objects of a SegmentedLog.
+type SegmentIter struct {
+	l    *SegmentedLog
+	from LogPos
+	id   uint64 // The segment being read
+	it   *LogIter
+	err  error
+	done bool
+}
+
+// Next advances to the next object, that is then available through Graph
+// and Pos. It returns false at the end of the log or on errors.
+func (it *SegmentIter) Next() bool {
+
+	for it.err == nil && !it.done {
+		if it.it == nil {
+			var log *Log
+			log, it.id, it.err = it.l.after(it.id, it.from.Segment)
+			if log == nil {
+				it.done = true
+				return false
+			}
+			off := int64(0)
+			if it.id == it.from.Segment {
+				off = it.from.Offset
+			}
+			it.it = log.Iter(off)
+		}
+
+		if it.it.Next() {
+			return true
+		}
+		it.err = it.it.Err()
+		it.it = nil
+	}
+	return false
+}
+
+// after returns the first segment with a number above id and not below min,
+// and its number. It returns nil at the end of the log, or on errors.
+func (l *SegmentedLog) after(id, min uint64) (*Log, uint64, error) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, s := range l.segs {
+		if s.id > id && s.id >= min {
+			log, err := l.segment(s.id)
+			return log, s.id, err
+		}
+	}
+	return nil, id, nil
+}
+
+// Graph returns the current object.
+func (it *SegmentIter) Graph() *Graph {
+	if it.it == nil {
+		return nil
+	}
+	return it.it.Graph()
+}
+
+// Pos returns the position of the current object.
+func (it *SegmentIter) Pos() LogPos {
+	if it.it == nil {
+		return LogPos{}
+	}
+	return LogPos{it.id, it.it.Offset()}
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *SegmentIter) Err() error {
+	return it.err
+}
+
+// Close ends the iteration. Segments are kept open by the log, so it is not
+// needed to release them.
+func (it *SegmentIter) Close() {
+	it.it = nil
+	it.done = true
+}
+
+// Compact rewrites the segments before the last one, keeping of the objects
+// that have a node at the given path (as 'id') only the last one with each
+// value of that node. Objects without it are kept. Segments left empty are
+// deleted.
+func (l *SegmentedLog) Compact(key string) error {
+
+	path := NewPath(key)
+
+	l.kmu.Lock()
+	defer l.kmu.Unlock()
+
+	// The segments to compact: those before the last one now, that don't
+	// change any more
+	l.mu.RLock()
+	old := make(map[uint64]bool)
+	for _, s := range l.segs[:len(l.segs)-1] {
+		old[s.id] = true
+	}
+	l.mu.RUnlock()
+
+	// The position of the last object for each key
+	last := make(map[string]LogPos)
+	it := l.Iter(LogPos{})
+	for it.Next() {
+		if k, ok := logKey(it.Graph(), path); ok {
+			last[k] = it.Pos()
+		}
+	}
+	if it.Err() != nil {
+		return it.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Segments deleted since are skipped, and those started kept
+	var segs []segment
+	for _, s := range l.segs {
+		if !old[s.id] {
+			segs = append(segs, s)
+			continue
+		}
+		n, err := l.compact(s.id, path, last)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			segs = append(segs, s)
+		}
+	}
+	return l.remove(segs)
+}
+
+// compact rewrites a segment, keeping the objects that are the last of their
+// key. It returns the number of objects kept.
+func (l *SegmentedLog) compact(id uint64, path *Graph, last map[string]LogPos) (int, error) {
+
+	log, err := l.segment(id)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := l.file(id) + ".tmp"
+	os.Remove(tmp)
+	out, err := OpenLogOptions(tmp, &LogOptions{Framed: log.framed})
+	if err != nil {
+		return 0, err
+	}
+	out.SetSync(false)
+
+	n, dropped := 0, false
+	it := log.Iter(0)
+	for it.Next() {
+		if k, ok := logKey(it.Graph(), path); ok && last[k] != (LogPos{id, it.Offset()}) {
+			dropped = true
+			continue
+		}
+		b, _, err := log.GetBinary(it.Offset())
+		if err == nil {
+			_, err = out.AddBinaryErr(b)
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(tmp)
+			return 0, err
+		}
+		n++
+	}
+	err = it.Err()
+	if err == nil {
+		err = out.sync(out.size())
+	}
+	out.Close()
+
+	if err != nil || !dropped {
+		os.Remove(tmp)
+		return n, err
+	}
+
+	// The index of the old segment doesn't match the new one
+	l.forget(id)
+	os.Remove(l.file(id) + ".idx")
+	return n, os.Rename(tmp, l.file(id))
+}
+
+// logKey returns the text of the node at the given path, if there is one.
+func logKey(g *Graph, path *Graph) (string, bool) {
+	n, _ := g.getPath(path)
+	if n == nil || n.Len() == 0 {
+		return "", false
+	}
+	return n.Text(), true
+}
+
+// full returns true if the last segment has reached its maximum size or age.
+func (l *SegmentedLog) full() bool {
+	size := l.cur.size()
+	if size == 0 {
+		return false
+	}
+	s := l.segs[len(l.segs)-1]
+	return l.opts.MaxSize > 0 && size >= l.opts.MaxSize || l.opts.MaxAge > 0 && time.Since(s.created) >= l.opts.MaxAge
+}
+
+// roll starts a new segment if the last one is full, and then applies the
+// retention policy.
+func (l *SegmentedLog) roll() error {
+
+	if !l.full() {
+		return nil
+	}
+	s := l.segs[len(l.segs)-1]
+
+	// The manifest is written first, so that a crash leaves at most an empty
+	// segment.
+	l.segs = append(l.segs, segment{s.id + 1, time.Now()})
+	if err := l.writeManifest(); err != nil {
+		l.segs = l.segs[:len(l.segs)-1]
+		return err
+	}
+
+	log, err := l.open(s.id + 1)
+	if err != nil {
+		// Back to the last segment, that keeps receiving objects
+		l.segs = l.segs[:len(l.segs)-1]
+		l.writeManifest()
+		return err
+	}
+
+	// The old segment stays open for reading
+	l.cmu.Lock()
+	l.closed[s.id] = l.cur
+	l.cmu.Unlock()
+	l.cur = log
+
+	return l.retain()
+}
+
+// retain deletes the segments beyond MaxSegments, and those closed (that is,
+// followed by a newer one) longer ago than Retention. The last segment is
+// never deleted.
+func (l *SegmentedLog) retain() error {
+
+	n := 0
+	if l.opts.MaxSegments > 0 && len(l.segs) > l.opts.MaxSegments {
+		n = len(l.segs) - l.opts.MaxSegments
+	}
+	if l.opts.Retention > 0 {
+		for n < len(l.segs)-1 && time.Since(l.segs[n+1].created) > l.opts.Retention {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	return l.remove(l.segs[n:])
+}
+
+// remove keeps the given segments, deleting the other ones.
+func (l *SegmentedLog) remove(keep []segment) error {
+
+	if len(keep) == len(l.segs) {
+		return nil
+	}
+
+	ids := make(map[uint64]bool)
+	for _, s := range keep {
+		ids[s.id] = true
+	}
+
+	old := l.segs
+	l.segs = keep
+	if err := l.writeManifest(); err != nil {
+		l.segs = old
+		return err
+	}
+
+	for _, s := range old {
+		if !ids[s.id] {
+			l.forget(s.id)
+			os.Remove(l.file(s.id))
+			os.Remove(l.file(s.id) + ".idx")
+		}
+	}
+	return nil
+}
+
+// segment returns a segment for reading: the last one, or one before it,
+// opened for reading only the first time it is asked for.
+func (l *SegmentedLog) segment(id uint64) (*Log, error) {
+
+	if id == l.segs[len(l.segs)-1].id {
+		return l.cur, nil
+	}
+
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+
+	if log := l.closed[id]; log != nil {
+		return log, nil
+	}
+	for _, s := range l.segs {
+		if s.id == id {
+			log, err := openLogRead(l.file(id))
+			if err != nil {
+				return nil, err
+			}
+			l.closed[id] = log
+			return log, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// forget closes a segment before the last one, if it is open.
+func (l *SegmentedLog) forget(id uint64) {
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+
+	if log := l.closed[id]; log != nil {
+		log.Close()
+		delete(l.closed, id)
+	}
+}
+
+// open opens the last segment, for writing.
+func (l *SegmentedLog) open(id uint64) (*Log, error) {
+	opts := l.opts.Log
+	return OpenLogOptions(l.file(id), &opts)
+}
+
+// file returns the file name of a segment.
+func (l *SegmentedLog) file(id uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%010d.log", id))
+}
+
+// readManifest reads the list of segments, if the manifest exists.
+func (l *SegmentedLog) readManifest() error {
+
+	file := filepath.Join(l.dir, "MANIFEST")
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+
+	g, err := ParseFile(file)
+	if err != nil {
+		return err
+	}
+
+	segs := g.Node("segments")
+	if segs == nil {
+		return ErrNotFound
+	}
+	for _, n := range segs.Out {
+		id, err := strconv.ParseUint(n.ThisString(), 10, 64)
+		if err != nil {
+			return err
+		}
+		t, err := time.Parse(time.RFC3339Nano, n.String())
+		if err != nil {
+			return err
+		}
+		l.segs = append(l.segs, segment{id, t})
+	}
+	return nil
+}
+
+// writeManifest replaces the manifest with the current list of segments.
+func (l *SegmentedLog) writeManifest() error {
+
+	g := New("_")
+	s := g.Add("segments")
+	for _, seg := range l.segs {
+		s.Add(strconv.FormatUint(seg.id, 10)).Add(seg.created.UTC().Format(time.RFC3339Nano))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := NewEncoder(buf).Encode(g); err != nil {
+		return err
+	}
+
+	// The new manifest is on disk before it replaces the old one, and the
+	// rename is on disk before returning
+	file := filepath.Join(l.dir, "MANIFEST")
+	f, err := os.Create(file + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(file + ".tmp")
+		return err
+	}
+	if err = os.Rename(file+".tmp", file); err != nil {
+		return err
+	}
+	syncDir(l.dir)
+	return nil
+}
+
+// syncDir commits the entries of a directory to disk. Not all systems
+// support it, so errors are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
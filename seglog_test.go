@@ -0,0 +1,333 @@
+package ogdl
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSegmentedLog(t *testing.T) {
+
+	dir := filepath.Join(os.TempDir(), "ogdl-seglog")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	l, err := OpenSegmentedLog(dir, &SegmentOptions{MaxSize: 100, Log: LogOptions{Framed: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Objects 0..19, with id 0, 1 or 2, except multiples of 5, that have none
+	var pos []LogPos
+	for i := 0; i < 20; i++ {
+		g := New("_")
+		g.Add("n").Add(strconv.Itoa(i))
+		if i%5 != 0 {
+			g.Add("id").Add(strconv.Itoa(i % 3))
+		}
+		p, err := l.Add(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pos = append(pos, p)
+	}
+
+	segs := l.Segments()
+	if len(segs) < 3 || pos[19].Segment != segs[len(segs)-1] {
+		t.Fatal("segments", segs, pos[19])
+	}
+	if g, err := l.Get(pos[7]); err != nil || g.Get("n").String() != "7" {
+		t.Error("Get", err)
+	}
+	l.Close()
+
+	// The manifest is read back, and iteration crosses segments
+	l, _ = OpenSegmentedLog(dir, &SegmentOptions{MaxSize: 100, Log: LogOptions{Framed: true}})
+	if len(l.Segments()) != len(segs) {
+		t.Error("reopen", l.Segments())
+	}
+	n := 3
+	it := l.Iter(pos[3])
+	for it.Next() {
+		if it.Pos() != pos[n] || it.Graph().Get("n").String() != strconv.Itoa(n) {
+			t.Error("Iter", n, it.Pos())
+		}
+		n++
+	}
+	if it.Err() != nil || n != 20 {
+		t.Error("Iter end", n, it.Err())
+	}
+
+	// Compaction keeps, before the last segment, the last object of each id
+	lastID := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		if i%5 != 0 {
+			lastID[strconv.Itoa(i%3)] = i
+		}
+	}
+	var want []string
+	for i := 0; i < 20; i++ {
+		if i%5 == 0 || pos[i].Segment == pos[19].Segment || lastID[strconv.Itoa(i%3)] == i {
+			want = append(want, strconv.Itoa(i))
+		}
+	}
+
+	if err = l.Compact("id"); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for it = l.Iter(LogPos{}); it.Next(); {
+		got = append(got, it.Graph().Get("n").String())
+	}
+	if it.Err() != nil || strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Error("Compact", got, want, it.Err())
+	}
+	if len(l.Segments()) >= len(segs) {
+		t.Error("Compact should delete empty segments", l.Segments())
+	}
+	l.Close()
+
+	// Retention by number of segments
+	l, _ = OpenSegmentedLog(dir, &SegmentOptions{MaxSegments: 2})
+	segs = l.Segments()
+	if len(segs) != 2 || segs[1] != pos[19].Segment {
+		t.Error("MaxSegments", segs)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 2 {
+		t.Error("MaxSegments files", files)
+	}
+	l.Close()
+
+	// Rolling by age, and retention by time
+	l, _ = OpenSegmentedLog(dir, &SegmentOptions{MaxAge: time.Nanosecond})
+	l.Add(FromString("a"))
+	l.Add(FromString("b"))
+	if s := l.Segments(); len(s) != 4 {
+		t.Error("MaxAge", s)
+	}
+	l.Close()
+
+	l, _ = OpenSegmentedLog(dir, &SegmentOptions{Retention: time.Nanosecond})
+	if s := l.Segments(); len(s) != 1 {
+		t.Error("Retention", s)
+	}
+	if it = l.Iter(LogPos{}); !it.Next() || it.Graph().String() != "b" || it.Next() {
+		t.Error("Retention keeps the last segment")
+	}
+	l.Close()
+}
+
+func TestSegmentedLogRollError(t *testing.T) {
+
+	dir := filepath.Join(os.TempDir(), "ogdl-seglog-roll")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	opts := &SegmentOptions{MaxSize: 1}
+	l, err := OpenSegmentedLog(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Add(FromString("a"))
+
+	// The next segment cannot be created
+	os.Mkdir(l.file(2), 0777)
+	if _, err = l.Add(FromString("b")); err == nil {
+		t.Error("Add should fail")
+	}
+	if s := l.Segments(); len(s) != 1 {
+		t.Error("Segments after a failed roll", s)
+	}
+	l.Close()
+
+	l, _ = OpenSegmentedLog(dir, opts)
+	if s := l.Segments(); len(s) != 1 {
+		t.Error("manifest after a failed roll", s)
+	}
+	os.Remove(l.file(2))
+	if pos, err := l.Add(FromString("b")); err != nil || pos.Segment != 2 {
+		t.Error("Add after a failed roll", pos, err)
+	}
+	l.Close()
+}
+
+func TestSegmentedLogRead(t *testing.T) {
+
+	dir := filepath.Join(os.TempDir(), "ogdl-seglog-read")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	opts := &SegmentOptions{MaxSize: 1, Log: LogOptions{Framed: true, Index: true}}
+	l, err := OpenSegmentedLog(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pos []LogPos
+	for _, s := range []string{"a", "b", "c"} {
+		p, _ := l.Add(FromString(s))
+		pos = append(pos, p)
+	}
+	l.Close()
+
+	// Reading older segments doesn't create or change files
+	idx, _ := filepath.Glob(filepath.Join(dir, "*.idx"))
+	for _, f := range idx {
+		os.Remove(f)
+	}
+	os.Remove(l.file(pos[1].Segment))
+
+	l, _ = OpenSegmentedLog(dir, opts)
+	if g, err := l.Get(pos[0]); err != nil || g.String() != "a" {
+		t.Error("Get", err)
+	}
+	if g, err := l.Get(pos[0]); err != nil || g.String() != "a" {
+		t.Error("Get again", err)
+	}
+	if _, err := l.Get(pos[1]); err == nil {
+		t.Error("Get from a missing segment")
+	}
+	l.Close()
+
+	if _, err := os.Stat(l.file(pos[1].Segment)); !os.IsNotExist(err) {
+		t.Error("a missing segment was created")
+	}
+	if idx, _ = filepath.Glob(filepath.Join(dir, "*.idx")); len(idx) != 1 {
+		t.Error("only the last segment is indexed", idx)
+	}
+}
+
+func TestSegmentedLogConcurrent(t *testing.T) {
+
+	dir := filepath.Join(os.TempDir(), "ogdl-seglog-concurrent")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	l, err := OpenSegmentedLog(dir, &SegmentOptions{MaxSize: 200, Log: LogOptions{Framed: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, objects = 8, 40
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	pos := make(map[LogPos]string)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < objects; i++ {
+				s := strconv.Itoa(w*objects + i)
+				p, err := l.Add(FromString("n " + s))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				pos[p] = s
+				mu.Unlock()
+
+				if g, err := l.Get(p); err != nil || g.Get("n").String() != s {
+					t.Error("Get", p, err)
+				}
+			}
+		}(w)
+	}
+
+	// Readers and compaction at the same time
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			for it := l.Iter(LogPos{}); it.Next(); {
+			}
+			l.Compact("id")
+		}
+	}()
+	wg.Wait()
+
+	if len(pos) != writers*objects {
+		t.Error("positions are not unique", len(pos))
+	}
+	n := 0
+	it := l.Iter(LogPos{})
+	for it.Next() {
+		if pos[it.Pos()] != it.Graph().Get("n").String() {
+			t.Error("Iter", it.Pos())
+		}
+		n++
+	}
+	if it.Err() != nil || n != writers*objects {
+		t.Error("Iter", n, it.Err())
+	}
+	l.Close()
+}
+
+func TestSegmentedLogCompactConcurrent(t *testing.T) {
+
+	dir := filepath.Join(os.TempDir(), "ogdl-seglog-compact")
+	defer os.RemoveAll(dir)
+
+	// Objects 0..59, with a unique id (multiples of 4) or one of 7 repeated
+	const objects = 60
+	lastID := make(map[string]int)
+	key := func(i int) string {
+		if i%4 == 0 {
+			return "u" + strconv.Itoa(i)
+		}
+		return "r" + strconv.Itoa(i%7)
+	}
+	for i := 0; i < objects; i++ {
+		lastID[key(i)] = i
+	}
+
+	for round := 0; round < 50; round++ {
+		os.RemoveAll(dir)
+		l, err := OpenSegmentedLog(dir, &SegmentOptions{MaxSize: 150, Log: LogOptions{Framed: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < objects; i++ {
+			if _, err := l.Add(FromString("n " + strconv.Itoa(i) + "\nid " + key(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var wg sync.WaitGroup
+		start := make(chan bool)
+		for c := 0; c < 2; c++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if err := l.Compact("id"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		// The last object of each id is kept
+		kept := make(map[int]bool)
+		it := l.Iter(LogPos{})
+		for it.Next() {
+			n, _ := strconv.Atoi(it.Graph().Get("n").String())
+			kept[n] = true
+		}
+		if it.Err() != nil {
+			t.Error(round, it.Err())
+		}
+		for k, n := range lastID {
+			if !kept[n] {
+				t.Error(round, "lost", k, n)
+			}
+		}
+		l.Close()
+	}
+}
@@ -44,6 +44,73 @@ var (
 	// ErrUnterminatedQuotedString is obvious.
 	ErrUnterminatedQuotedString = errors.New("quoted string not terminated")
 
+	// ErrInvalidIndentation indicates a line with less indentation than the first one
+	ErrInvalidIndentation = errors.New("line indented less than the first line")
+
+	// ErrUnexpectedChar indicates a control character in OGDL text
+	ErrUnexpectedChar = errors.New("unexpected control character")
+
+	// ErrUndefinedReference indicates a reference, +{name}, without anchor
+	ErrUndefinedReference = errors.New("reference to an undefined anchor")
+
+	// ErrDanglingAnchor indicates an anchor, -{name}, not followed by a node
+	ErrDanglingAnchor = errors.New("anchor not followed by a node")
+
+	// ErrUnbalancedParens indicates a group, '(', not closed in the same line
+	ErrUnbalancedParens = errors.New("unbalanced parenthesis")
+
+	// ErrInvalidInclude indicates an !include directive not followed by one file name
+	ErrInvalidInclude = errors.New("!include needs one file name")
+
+	// ErrIncludeCycle indicates a file that includes itself, directly or not
+	ErrIncludeCycle = errors.New("include cycle")
+
+	// ErrIncludeDepth indicates includes nested deeper than MaxIncludeDepth
+	ErrIncludeDepth = errors.New("includes nested too deep")
+
+	// ErrUnknownField indicates a node without a struct field to decode it into
+	ErrUnknownField = errors.New("unknown field")
+
+	// ErrCycle indicates a Go value that contains itself, and cannot be marshaled,
+	// or a graph that contains itself, and cannot be decoded
+	ErrCycle = errors.New("cycle in value")
+
+	// ErrBinaryHeader indicates a stream that doesn't start with a binary OGDL header
+	ErrBinaryHeader = errors.New("not a binary OGDL header")
+
+	// ErrBinaryTruncated indicates a binary OGDL stream that ends in the middle of a graph
+	ErrBinaryTruncated = errors.New("truncated graph")
+
+	// ErrBinaryLevel indicates a node more than one level deeper than the previous one
+	ErrBinaryLevel = errors.New("level jump")
+
+	// ErrBinaryNode indicates a node of unknown type, or an invalid integer or time
+	ErrBinaryNode = errors.New("invalid node")
+
+	// ErrNodeTooLarge indicates a node larger than BinaryDecoder.MaxNodeSize
+	ErrNodeTooLarge = errors.New("node too large")
+
+	// ErrTooDeep indicates a node deeper than BinaryDecoder.MaxDepth
+	ErrTooDeep = errors.New("graph too deep")
+
+	// ErrTooLarge indicates a graph larger than BinaryDecoder.MaxBytes
+	ErrTooLarge = errors.New("graph too large")
+
+	// ErrLogRecord indicates a record of a framed log that is incomplete or has a bad header
+	ErrLogRecord = errors.New("bad log record")
+
+	// ErrChecksum indicates a record of a framed log whose data doesn't match its CRC32
+	ErrChecksum = errors.New("checksum mismatch")
+
+	// ErrSequence indicates a record of a framed log out of sequence
+	ErrSequence = errors.New("record out of sequence")
+
+	// ErrLogFormat indicates a framed log asked for on a file with unframed objects
+	ErrLogFormat = errors.New("log file is not framed")
+
+	// ErrNoTimeIndex indicates a search by time in a log without a time index
+	ErrNoTimeIndex = errors.New("log has no time index")
+
 	ErrNotANumber       = errors.New("not a number")
 	ErrNotFound         = errors.New("not found")
 	ErrIncompatibleType = errors.New("incompatible type")